@@ -0,0 +1,130 @@
+// Package ast describes mustache templates as mussed parses them, before
+// they are lowered to text/template/parse trees. Tools can use it to see
+// the sections, partials, comments and other tags of a template along with
+// where in the source each one was found.
+package ast
+
+// Pos is a byte offset in the template source.
+type Pos int
+
+// Position returns p, so Pos can be embedded to give nodes a position.
+func (p Pos) Position() Pos {
+	return p
+}
+
+// Node is an element of a template, either text or a tag.
+type Node interface {
+	Position() Pos
+}
+
+// Template is a parsed template.
+type Template struct {
+	Name      string // name the template is defined as
+	ParseName string // name the template was parsed as
+	Source    string
+	Nodes     []Node
+
+	// Left and Right are the delimiters the template starts with, which
+	// the output of interpolation lambdas is rendered against
+	Left  string
+	Right string
+}
+
+// Text is literal text between tags. Standalone tags do not leave their
+// line's indentation and line break behind as text, and the content of a
+// block whose opening tag ends its line loses the indentation of its first
+// line.
+type Text struct {
+	Pos
+	Line int
+	Text string
+}
+
+// Tag is the location and source text of a tag.
+type Tag struct {
+	Pos
+	Line int
+	Raw  string
+}
+
+// Variable is an interpolation tag, {{name}}, or an unescaped one,
+// {{{name}}} or {{&name}}.
+type Variable struct {
+	Tag
+	Name      string
+	Unescaped bool
+
+	// Filters names functions of the template's FuncMap that the value is
+	// piped through, in order, before it is escaped. Mustache has no
+	// syntax for them so parsing never sets Filters, they are for tools
+	// rewriting templates.
+	Filters []string
+}
+
+// Section is a {{#name}} tag and the nodes up to its closing tag.
+type Section struct {
+	Tag
+	Name  string
+	Nodes []Node
+	End   Tag // the closing tag, zero when it is missing
+
+	// Body is the unprocessed source between the tags, which is what
+	// section lambdas are given, and Left and Right the delimiters in
+	// effect at the opening tag.
+	Body  string
+	Left  string
+	Right string
+}
+
+// InvertedSection is a {{^name}} tag and the nodes up to its closing tag.
+type InvertedSection struct {
+	Tag
+	Name  string
+	Nodes []Node
+	End   Tag
+}
+
+// Partial is a {{>name}} tag, or a {{>*field}} tag when Dynamic, where the
+// partial is named by field.
+type Partial struct {
+	Tag
+	Name    string
+	Dynamic bool
+	Indent  string // indentation of a standalone partial tag
+}
+
+// Comment is a {{!text}} tag.
+type Comment struct {
+	Tag
+	Text string
+}
+
+// SetDelimiters is a {{=left right=}} tag.
+type SetDelimiters struct {
+	Tag
+	Left  string
+	Right string
+}
+
+// Parent is a {{<name}} tag, which renders the parent template with the
+// blocks inside it overriding the parent's blocks.
+type Parent struct {
+	Tag
+	Name   string
+	Nodes  []Node
+	End    Tag
+	Indent string // indentation of a standalone parent tag
+}
+
+// Block is a {{$name}} tag, overriding a block when directly inside a
+// Parent and otherwise marking a region a child template can replace.
+type Block struct {
+	Tag
+	Name  string
+	Nodes []Node
+	End   Tag
+
+	// Indent is the whitespace before a region's tag on its line, when
+	// there is nothing else, which its content is indented by.
+	Indent string
+}
@@ -0,0 +1,81 @@
+package ast
+
+// Position returns 0, the start of the template, so a Template can be
+// walked like any other node.
+func (t *Template) Position() Pos {
+	return 0
+}
+
+// A Visitor's Visit method is called for every node Walk finds. When the
+// visitor w it returns is not nil, Walk visits the children of n with w
+// and then calls w.Visit(nil).
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+// Walk visits n and then everything within it, in source order.
+func Walk(v Visitor, n Node) {
+	if v = v.Visit(n); v == nil {
+		return
+	}
+	if nodes := children(n); nodes != nil {
+		for _, child := range *nodes {
+			Walk(v, child)
+		}
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f for n and everything within it, in source order,
+// skipping the children of a node when f returns false for it. After the
+// children of a node have been inspected f is called with nil.
+func Inspect(n Node, f func(Node) bool) {
+	Walk(inspector(f), n)
+}
+
+// Rewrite calls f for n and everything within it, in source order, and
+// replaces each node with what f returns. Returning nil removes the node
+// from the nodes it is in. The children of a node are rewritten after f
+// has been called for it, so the children of the node f returns are the
+// ones rewritten. Rewrite returns what f returned for n.
+func Rewrite(n Node, f func(Node) Node) Node {
+	if n = f(n); n == nil {
+		return nil
+	}
+	if nodes := children(n); nodes != nil {
+		kept := (*nodes)[:0]
+		for _, child := range *nodes {
+			if child = Rewrite(child, f); child != nil {
+				kept = append(kept, child)
+			}
+		}
+		*nodes = kept
+	}
+	return n
+}
+
+// children returns the nodes within n, or nil when n cannot hold nodes.
+func children(n Node) *[]Node {
+	switch n := n.(type) {
+	case *Template:
+		return &n.Nodes
+	case *Section:
+		return &n.Nodes
+	case *InvertedSection:
+		return &n.Nodes
+	case *Parent:
+		return &n.Nodes
+	case *Block:
+		return &n.Nodes
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package mussed
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/acsellers/mussed/ast"
+)
+
+func TestParseASTNodes(t *testing.T) {
+	// Every kind of tag has its own node, located in the source
+
+	within(t, func(test *aTest) {
+		tmpl, err := ParseAST("test.mustache", "hi {{name}}{{{raw}}}{{! note }}\n{{#list}}\n  {{>item}}\n{{/list}}{{^empty}}none{{/empty}}{{=<% %>=}}<%>*dyn%>")
+		test.IsNil(err)
+		test.AreEqual("test", tmpl.Name)
+		test.AreEqual("test.mustache", tmpl.ParseName)
+		test.AreEqual(9, len(tmpl.Nodes))
+
+		text, ok := tmpl.Nodes[0].(*ast.Text)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("hi ", text.Text)
+		}
+
+		v, ok := tmpl.Nodes[1].(*ast.Variable)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("name", v.Name)
+			test.AreEqual("{{name}}", v.Raw)
+			test.AreEqual(ast.Pos(3), v.Position())
+			test.IsFalse(v.Unescaped)
+		}
+		v, ok = tmpl.Nodes[2].(*ast.Variable)
+		test.IsTrue(ok && v.Unescaped)
+
+		c, ok := tmpl.Nodes[3].(*ast.Comment)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("note", c.Text)
+		}
+
+		s, ok := tmpl.Nodes[5].(*ast.Section)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("list", s.Name)
+			test.AreEqual(2, s.Line)
+			test.AreEqual(4, s.End.Line)
+			test.AreEqual("{{/list}}", s.End.Raw)
+			test.AreEqual(1, len(s.Nodes))
+			p, ok := s.Nodes[0].(*ast.Partial)
+			test.IsTrue(ok)
+			if ok {
+				test.AreEqual("item", p.Name)
+				test.AreEqual("  ", p.Indent)
+				test.AreEqual(3, p.Line)
+			}
+		}
+
+		i, ok := tmpl.Nodes[6].(*ast.InvertedSection)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("empty", i.Name)
+			test.AreEqual(1, len(i.Nodes))
+		}
+
+		d, ok := tmpl.Nodes[7].(*ast.SetDelimiters)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("<%", d.Left)
+			test.AreEqual("%>", d.Right)
+		}
+
+		p, ok := tmpl.Nodes[8].(*ast.Partial)
+		test.IsTrue(ok && p.Dynamic && p.Name == "dyn")
+
+		tmpl, err = ParseAST("test.mustache", "{{#a}}x {{b}}{{/a}}")
+		test.IsNil(err)
+		s, ok = tmpl.Nodes[0].(*ast.Section)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("x {{b}}", s.Body)
+		}
+	})
+}
+
+func TestParseASTInheritance(t *testing.T) {
+	// Parent tags hold their blocks, everything else is kept for tools
+
+	within(t, func(test *aTest) {
+		tmpl, err := ParseAST("test.mustache", "{{<parent}}{{$title}}T{{/title}}ignored{{/parent}}{{$footer}}F{{/footer}}")
+		test.IsNil(err)
+		test.AreEqual(2, len(tmpl.Nodes))
+
+		p, ok := tmpl.Nodes[0].(*ast.Parent)
+		test.IsTrue(ok)
+		if ok {
+			test.AreEqual("parent", p.Name)
+			test.AreEqual(2, len(p.Nodes))
+			b, ok := p.Nodes[0].(*ast.Block)
+			test.IsTrue(ok && b.Name == "title")
+		}
+		b, ok := tmpl.Nodes[1].(*ast.Block)
+		test.IsTrue(ok && b.Name == "footer")
+	})
+}
+
+func TestLower(t *testing.T) {
+	// Lowering a parsed template gives the trees Parse does
+
+	within(t, func(test *aTest) {
+		source := "{{#a}}{{b}}{{/a}}{{^c}}{{>d}}{{/c}}"
+		tmpl, err := ParseAST("test.mustache", source)
+		test.IsNil(err)
+		trees, err := Parse("test.mustache", source)
+		test.IsNil(err)
+
+		lowered := Lower(tmpl)
+		test.AreEqual(len(trees), len(lowered))
+		for name := range trees {
+			_, ok := lowered[name]
+			test.IsTrue(ok, name, "missing from lowered trees")
+		}
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	// Rewrites rename variables and partials, strip comments and add filters
+
+	within(t, func(test *aTest) {
+		tmpl, err := ParseAST("test.mustache", `{{! old }}{{#list}}{{name}} {{>row}}{{/list}}`)
+		test.IsNil(err)
+		ast.Rewrite(tmpl, func(n ast.Node) ast.Node {
+			switch n := n.(type) {
+			case *ast.Comment:
+				return nil
+			case *ast.Variable:
+				n.Name = "title"
+				n.Filters = append(n.Filters, "upper")
+			case *ast.Partial:
+				n.Name = "line"
+			}
+			return n
+		})
+
+		var kinds []string
+		ast.Inspect(tmpl, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.Comment:
+				kinds = append(kinds, "comment")
+			case *ast.Variable:
+				kinds = append(kinds, "variable")
+			case *ast.Partial:
+				kinds = append(kinds, "partial")
+			}
+			return true
+		})
+		test.AreEqual("variable partial", strings.Join(kinds, " "))
+
+		t := template.New("test").Funcs(RequiredFuncs).Funcs(template.FuncMap{"upper": strings.ToUpper})
+		for name, tree := range Lower(tmpl) {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+		t, err = t.New("line").Parse(`[line]`)
+		test.IsNil(err)
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{
+			"list": []map[string]string{{"title": "a"}, {"title": "b"}},
+		}))
+		test.AreEqual("A [line]B [line]", b.String())
+	})
+}
@@ -0,0 +1,218 @@
+package mussed
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+var errNotAttached = errors.New("mussed: template needs other templates at render time, use mussed.Attach on the template set")
+
+// Attach installs RequiredFuncs on t along with the helpers that execute
+// other templates of t's set while rendering. These are needed by
+// templates using inheritance ({{<parent}} and {{$block}}) and dynamic
+// partials ({{>*name}}), to indent every line of indented standalone
+// partials, and by section lambdas returning partials or parents. Attach t
+// before it is first executed; templates added to the set afterwards are
+// found as well.
+func Attach(t *template.Template) *template.Template {
+	r := &runner{set: t}
+	return t.Funcs(RequiredFuncs).Funcs(r.funcs())
+}
+
+// runner executes the templates of set while it renders. The set of a
+// section lambda's output has the runner of the set the lambda was called
+// from as its parent, which executes the templates the lambda's set lacks.
+type runner struct {
+	set    *template.Template
+	parent *runner
+}
+
+func (r *runner) funcs() template.FuncMap {
+	return template.FuncMap{
+		"mussedAttached":       func() bool { return true },
+		"mussedBlock":          r.block,
+		"mussedPartial":        r.partial,
+		"mussedDynamicPartial": r.dynamicPartial,
+		"mussedOverride":       r.override,
+		"mussedSectionLambda":  r.sectionLambda,
+	}
+}
+
+// block renders the override registered for name, or the default content
+// in tmpl when no child template overrode it, indented to match the block
+// tag.
+func (r *runner) block(ctx interface{}, name, tmpl, indent string) (template.HTML, error) {
+	if override, ok := scopeOf(ctx).blocks[name]; ok {
+		tmpl = override.tmpl
+		if override.runner != nil {
+			r = override.runner
+		}
+	}
+	return indented(ctx, indent, func(ctx interface{}) (template.HTML, error) {
+		return r.execute(tmpl, ctx)
+	})
+}
+
+// partial renders the named template, indenting its lines to match the
+// standalone partial tag that called it.
+func (r *runner) partial(ctx interface{}, name, indent string) (template.HTML, error) {
+	return indented(ctx, indent, func(ctx interface{}) (template.HTML, error) {
+		return r.execute(name, ctx)
+	})
+}
+
+// dynamicPartial renders the partial whose name was found in the data.
+// Like mustache, a name that does not match a template renders nothing.
+func (r *runner) dynamicPartial(ctx, name interface{}, indent string) (template.HTML, error) {
+	if name == nil {
+		return "", nil
+	}
+	tmpl := fmt.Sprint(name)
+	if tmpl == "" || !r.defines(tmpl) {
+		return "", nil
+	}
+	return r.partial(ctx, tmpl, indent)
+}
+
+// defines reports whether r, or a runner it falls back on, has a template
+// called name.
+func (r *runner) defines(name string) bool {
+	for ; r != nil; r = r.parent {
+		if r.set.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// newLineMark returns the mark that stands in for the line breaks of
+// interpolated values while an indented partial or block renders, so only
+// the lines of the templates themselves are indented, as mustache does. It
+// is drawn at random for each render so that no value or template text
+// holds it, as they might any fixed character.
+func newLineMark() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("\ue000%x\ue000", b)
+}
+
+// indented renders with render, prefixing each line of the output with
+// indent. Interpolated values have their line breaks marked while it
+// renders, see markLines, and the outermost indented render puts them back.
+func indented(ctx interface{}, indent string, render func(interface{}) (template.HTML, error)) (template.HTML, error) {
+	if indent == "" {
+		return render(ctx)
+	}
+	mark := lineMark(ctx)
+	outer := mark == ""
+	if outer {
+		mark = newLineMark()
+		s := withState(ctx)
+		s.lineMark = mark
+		ctx = s
+	}
+	out, err := render(ctx)
+	if err != nil || out == "" {
+		return out, err
+	}
+	s := indentLines(string(out), indent)
+	if outer {
+		s = strings.Replace(s, mark, "\n", -1)
+	}
+	return template.HTML(s), nil
+}
+
+// lineMark returns the mark for line breaks when ctx is rendered inside an
+// indented partial or block, and "" otherwise.
+func lineMark(ctx interface{}) string {
+	if s, ok := ctx.(*scope); ok {
+		return s.lineMark
+	}
+	return ""
+}
+
+// markLines replaces the line breaks in v, an interpolated value, with the
+// line mark when it is rendered inside an indented partial or block.
+func markLines(ctx, v interface{}) interface{} {
+	mark := lineMark(ctx)
+	if v == nil || mark == "" {
+		return v
+	}
+	switch s := v.(type) {
+	case string:
+		return strings.Replace(s, "\n", mark, -1)
+	case template.HTML:
+		return template.HTML(strings.Replace(string(s), "\n", mark, -1))
+	}
+	if s := fmt.Sprint(v); strings.Contains(s, "\n") {
+		return strings.Replace(s, "\n", mark, -1)
+	}
+	return v
+}
+
+// indentLines prefixes each line in s with indent. A final line break is
+// left alone, as it ends the partial rather than starting a new line.
+func indentLines(s, indent string) string {
+	trailing := strings.HasSuffix(s, "\n")
+	if trailing {
+		s = s[:len(s)-1]
+	}
+	s = indent + strings.Replace(s, "\n", "\n"+indent, -1)
+	if trailing {
+		s += "\n"
+	}
+	return s
+}
+
+func (r *runner) execute(name string, ctx interface{}) (template.HTML, error) {
+	if r.parent != nil && r.set.Lookup(name) == nil {
+		return r.parent.execute(name, ctx)
+	}
+	b := new(bytes.Buffer)
+	if err := r.set.ExecuteTemplate(b, name, ctx); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// blockOverride is the template overriding a block, and the runner of the
+// set it is in, nil when the set was not attached.
+type blockOverride struct {
+	tmpl   string
+	runner *runner
+}
+
+// override pushes the blocks of a child template into scope before its
+// parent is rendered. Blocks already in scope came from a template further
+// down the inheritance chain and win over these.
+func override(ctx interface{}, pairs ...string) (*scope, error) {
+	return (*runner)(nil).override(ctx, pairs...)
+}
+
+// override pushes the blocks of a child template in r's set, see override.
+func (r *runner) override(ctx interface{}, pairs ...string) (*scope, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("mussed: odd number of block overrides")
+	}
+	dot := withState(ctx)
+	blocks := make(map[string]blockOverride)
+	for name, block := range dot.blocks {
+		blocks[name] = block
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := blocks[pairs[i]]; !ok {
+			blocks[pairs[i]] = blockOverride{tmpl: pairs[i+1], runner: r}
+		}
+	}
+	dot.blocks = blocks
+
+	return dot, nil
+}
+
+func notAttached(...interface{}) (string, error) {
+	return "", errNotAttached
+}
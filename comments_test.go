@@ -6,6 +6,9 @@ import (
   "encoding/json"
   "testing"
   "html/template"
+  "text/template/parse"
+
+  "github.com/acsellers/mussed/ast"
 )
 
 /*
@@ -126,9 +129,7 @@ func TestCOMMENTS4(t *testing.T) {
 
   within(t, func(test *aTest) {
 		t := template.New("test").Funcs(RequiredFuncs)
-		trees, err := Parse("test.mustache",`|
-{{! Standalone Comment }}
-|`)
+		trees, err := Parse("test.mustache","|\r\n{{! Standalone Comment }}\r\n|")
 		test.IsNil(err)
     for name, tree := range trees {
       t, err = t.AddParseTree(name, tree)
@@ -139,8 +140,7 @@ func TestCOMMENTS4(t *testing.T) {
     test.IsNil(json.Unmarshal([]byte(`{}`), &data))
 		b := new(bytes.Buffer)
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
-		test.AreEqual(`|
-|`, b.String())
+		test.AreEqual("|\r\n|", b.String())
   })
 }
 
@@ -289,3 +289,68 @@ func TestCOMMENTS10(t *testing.T) {
   })
 }
 
+
+func TestCOMMENTSMultilineTrailingText(t *testing.T) {
+	// Text after the end of a multi-line comment is kept
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `Begin.
+{{!
+Something's going on here...
+}} {{b}} End.
+{{! single }} after
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"b":"Middle."}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Begin.
+ Middle. End.
+ after
+`, b.String())
+	})
+}
+
+func TestCOMMENTSKeptAsNodes(t *testing.T) {
+	// Comments are kept in the parse output but still render nothing
+
+	within(t, func(test *aTest) {
+		source := "Begin.\n  {{! standalone }}\n{{!\n  multi\n}}\nEnd.{{!inline}}\n"
+		tmpl, err := ParseAST("test.mustache", source)
+		test.IsNil(err)
+		var comments []string
+		ast.Inspect(tmpl, func(n ast.Node) bool {
+			if c, ok := n.(*ast.Comment); ok {
+				comments = append(comments, c.Text)
+			}
+			return true
+		})
+		test.AreEqual([]string{"standalone", "multi", "inline"}, comments)
+
+		trees, err := Parse("test.mustache", source)
+		test.IsNil(err)
+		var nodes []string
+		for _, node := range trees["test"].Root.Nodes {
+			if c, ok := node.(*parse.CommentNode); ok {
+				nodes = append(nodes, c.String())
+			}
+		}
+		test.AreEqual([]string{"{{/*standalone*/}}", "{{/*multi*/}}", "{{/*inline*/}}"}, nodes)
+
+		t := template.New("test").Funcs(RequiredFuncs)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", nil))
+		test.AreEqual("Begin.\nEnd.\n", b.String())
+	})
+}
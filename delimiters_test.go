@@ -297,9 +297,7 @@ func TestDELIMITERS10(t *testing.T) {
 
 	within(t, func(test *aTest) {
 		t := template.New("test").Funcs(RequiredFuncs)
-		trees, err := Parse("test.mustache", `|
-{{= @ @ =}}
-|`)
+		trees, err := Parse("test.mustache", "|\r\n{{= @ @ =}}\r\n|")
 		test.IsNil(err)
 		for name, tree := range trees {
 			t, err = t.AddParseTree(name, tree)
@@ -310,8 +308,7 @@ func TestDELIMITERS10(t *testing.T) {
 		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
 		b := new(bytes.Buffer)
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
-		test.AreEqual(`|
-|`, b.String())
+		test.AreEqual("|\r\n|", b.String())
 	})
 }
 
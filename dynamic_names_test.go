@@ -0,0 +1,248 @@
+package mussed
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"testing"
+)
+
+/*
+Rather than naming a partial directly, a Dynamic Name names the data
+holding the partial's name. The name is looked up in the context stack when
+the template is rendered, and the partial is expanded exactly as if it had
+been named statically.
+
+Dynamic Names are indicated by a single asterisk before the name in the
+partial tag. If the looked up name does not match a template, the empty
+string is used instead.
+
+*/
+
+func TestDYNAMICNAMES0(t *testing.T) {
+	// Basic Behavior - Partial
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*dynamic}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("content.mustache", `Hello, world!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"dynamic":"content"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`"Hello, world!"`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES1(t *testing.T) {
+	// Basic Behavior - Name Resolution
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*dynamic}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("content.mustache", `Hello, world!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("wrong.mustache", `Invisible`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"dynamic":"content","*dynamic":"wrong"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`"Hello, world!"`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES2(t *testing.T) {
+	// Context
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*example}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("partial.mustache", `*{{text}}*`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"text":"content","example":"partial"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`"*content*"`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES3(t *testing.T) {
+	// Dotted Names
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*foo.bar.baz}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("partial.mustache", `Hello, world!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"foo":{"bar":{"baz":"partial"}}}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`"Hello, world!"`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES4(t *testing.T) {
+	// Dotted Names - Failed Lookup
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*foo.bar.baz}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("partial.mustache", `Hello, world!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"foo":{"bar":{}}}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`""`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES5(t *testing.T) {
+	// Missing Partial
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `"{{>*dynamic}}"`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("content.mustache", `Hello, world!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"dynamic":"missing"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`""`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES6(t *testing.T) {
+	// Standalone Indentation
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `|
+  {{>*dynamic}}
+|`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("partial.mustache", `>
+>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"dynamic":"partial"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`|
+  >
+  >|`, b.String())
+	})
+}
+
+func TestDYNAMICNAMES7(t *testing.T) {
+	// Padding Whitespace
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `|{{> * dynamic }}|`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("partial.mustache", `[]`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"dynamic":"partial"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`|[]|`, b.String())
+	})
+}
@@ -0,0 +1,235 @@
+package mussed
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/acsellers/mussed/ast"
+)
+
+// ParseError describes a problem found while parsing a template, located
+// in the template source so authors can be pointed at the offending tag.
+type ParseError struct {
+	Name    string // name the template was parsed as
+	Line    int    // 1 based line of the problem
+	Col     int    // 1 based byte column of the problem
+	Tag     string // text of the offending tag
+	Snippet string // the source line with a caret under the problem
+	Msg     string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("mussed: %s:%d:%d: %s", e.Name, e.Line, e.Col, e.Msg)
+}
+
+// ParseErrors holds the problems found in a template, in source order.
+// Only the first maxProblems are kept. It unwraps like the errors made by
+// errors.Join, so errors.As will find the first *ParseError.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, pe := range e {
+		errs[i] = pe
+	}
+	return errs
+}
+
+// problem is a ParseError waiting for the rest of the source to be read,
+// so its snippet can show the whole line.
+type problem struct {
+	pos int
+	tag string
+	msg string
+}
+
+// maxProblems caps the problems reported for a template, as a source that
+// is not a mustache template at all may have a problem on every line.
+const maxProblems = 100
+
+// errorf records a problem at offset pos of the source, parsing then
+// carries on so every problem is reported at once.
+func (pt *protoTree) errorf(pos int, tag, format string, args ...interface{}) {
+	if len(pt.problems) == maxProblems {
+		return
+	}
+	pt.problems = append(pt.problems, problem{pos: pos, tag: tag, msg: fmt.Sprintf(format, args...)})
+}
+
+// error returns the problems found while parsing, or nil. The problems are
+// located in a single pass over the source, in order of their offsets.
+func (pt *protoTree) error() error {
+	if len(pt.problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(pt.problems, func(i, j int) bool {
+		return pt.problems[i].pos < pt.problems[j].pos
+	})
+
+	errs := make(ParseErrors, len(pt.problems))
+	line, lineStart := 1, 0
+	for i, p := range pt.problems {
+		if p.pos > len(pt.source) {
+			p.pos = len(pt.source)
+		}
+		for {
+			next := strings.IndexByte(pt.source[lineStart:p.pos], '\n')
+			if next < 0 {
+				break
+			}
+			line++
+			lineStart += next + 1
+		}
+		errs[i] = pt.newError(p, line, lineStart)
+	}
+	return errs
+}
+
+// newError makes the ParseError for p, found on the given line of the
+// source, which starts at offset lineStart.
+func (pt *protoTree) newError(p problem, line, lineStart int) *ParseError {
+	lineEnd := strings.IndexByte(pt.source[p.pos:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(pt.source)
+	} else {
+		lineEnd += p.pos
+	}
+	text := strings.TrimSuffix(pt.source[lineStart:lineEnd], "\r")
+
+	// keep tabs in the caret line so the caret lines up with the source
+	caret := []byte(pt.source[lineStart:p.pos])
+	for i, c := range caret {
+		if c != '\t' {
+			caret[i] = ' '
+		}
+	}
+
+	return &ParseError{
+		Name:    pt.template.ParseName,
+		Line:    line,
+		Col:     p.pos - lineStart + 1,
+		Tag:     p.tag,
+		Snippet: text + "\n" + string(caret) + "^",
+		Msg:     p.msg,
+	}
+}
+
+// RenderError locates a failure executing a template in the mustache
+// source, rather than in the trees generated for it.
+type RenderError struct {
+	Name     string // name the template was parsed as
+	Template string // name of the template in its set
+	Line     int    // 1 based line of the failing tag
+	Col      int    // 1 based byte column of the failing tag
+	Tag      string // text of the failing tag
+	Msg      string
+	Err      error // the error returned by text/template
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("mussed: %s:%d:%d: executing %s: %s", e.Name, e.Line, e.Col, e.Tag, e.Msg)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// execContext matches the location and message of a text/template
+// execution error.
+var execContext = regexp.MustCompile(`(?s)^template: (.*?):(\d+):(\d+): executing "(?:[^"\\]|\\.)*" at <.*?>: (.*)$`)
+
+// Locator turns errors executing templates into *RenderErrors naming the
+// mustache template, line and tag that failed. It finds the tags in the
+// syntax trees added to it, which ParseAST returns before Lower turns them
+// into the trees of the template set. The zero value is ready to use.
+type Locator struct {
+	templates map[string]*ast.Template
+}
+
+// Add makes the tags of t known to the Locator.
+func (l *Locator) Add(t *ast.Template) {
+	if l.templates == nil {
+		l.templates = make(map[string]*ast.Template)
+	}
+	l.templates[t.Name] = t
+}
+
+// Locate rewrites err, returned when executing a template added to the
+// Locator, into a *RenderError. Errors that did not come from executing a
+// tag of one of its templates are returned as they are.
+func (l *Locator) Locate(err error) error {
+	var execErr texttemplate.ExecError
+	if !errors.As(err, &execErr) {
+		return err
+	}
+	name := execErr.Name
+	if i := strings.Index(name, ".mussedAnonymous"); i >= 0 {
+		name = name[:i]
+	}
+	t := l.templates[name]
+	match := execContext.FindStringSubmatch(execErr.Err.Error())
+	if t == nil || match == nil {
+		return err
+	}
+
+	line, _ := strconv.Atoi(match[2])
+	col, _ := strconv.Atoi(match[3])
+	var found *ast.Tag
+	ast.Inspect(t, func(n ast.Node) bool {
+		if tag := tagOf(n); tag != nil && tag.Line == line {
+			lineStart := strings.LastIndex(t.Source[:tag.Pos], "\n") + 1
+			if int(tag.Pos)-lineStart == col {
+				found = tag
+			}
+		}
+		return found == nil
+	})
+	if found == nil {
+		return err
+	}
+	return &RenderError{
+		Name:     match[1],
+		Template: name,
+		Line:     line,
+		Col:      col + 1,
+		Tag:      found.Raw,
+		Msg:      match[4],
+		Err:      err,
+	}
+}
+
+// tagOf returns the opening tag of n, or nil for text and templates.
+func tagOf(n ast.Node) *ast.Tag {
+	switch n := n.(type) {
+	case *ast.Variable:
+		return &n.Tag
+	case *ast.Section:
+		return &n.Tag
+	case *ast.InvertedSection:
+		return &n.Tag
+	case *ast.Partial:
+		return &n.Tag
+	case *ast.Comment:
+		return &n.Tag
+	case *ast.SetDelimiters:
+		return &n.Tag
+	case *ast.Parent:
+		return &n.Tag
+	case *ast.Block:
+		return &n.Tag
+	}
+	return nil
+}
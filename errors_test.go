@@ -0,0 +1,266 @@
+package mussed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseErrorUnterminated(t *testing.T) {
+	// An unterminated tag is reported where it starts
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "line one\n  {{a}}{{b\nthree")
+		test.IsNotNil(err)
+
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual("test.mustache", pe.Name)
+		test.AreEqual(2, pe.Line)
+		test.AreEqual(8, pe.Col)
+		test.AreEqual("{{b", pe.Tag)
+		test.AreEqual("  {{a}}{{b\n       ^", pe.Snippet)
+		test.AreEqual(`mussed: test.mustache:2:8: unterminated tag, expected "}}"`, pe.Error())
+	})
+}
+
+func TestParseErrorUnterminatedTriple(t *testing.T) {
+	// Triple mustaches expect their own closing delimiter
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "\t{{{a}}")
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual(1, pe.Line)
+		test.AreEqual(2, pe.Col)
+		test.AreEqual("\t{{{a}}\n\t^", pe.Snippet)
+		test.AreEqual(`mussed: test.mustache:1:2: unterminated tag, expected "}}}"`, pe.Error())
+	})
+}
+
+func TestParseErrorMismatchedClose(t *testing.T) {
+	// Closing tags must match the innermost open section
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "{{#a}}\n{{#b}}{{/a}}{{/b}}")
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual(2, pe.Line)
+		test.AreEqual(7, pe.Col)
+		test.AreEqual("{{/a}}", pe.Tag)
+		test.AreEqual(`closing tag for "a" does not match section "b" opened on line 2`, pe.Msg)
+	})
+}
+
+func TestParseErrorUnopenedClose(t *testing.T) {
+	// Closing tags need an open section
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "text {{/a}}")
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual(1, pe.Line)
+		test.AreEqual(6, pe.Col)
+		test.AreEqual(`closing tag for "a" without an open section`, pe.Msg)
+	})
+}
+
+func TestParseErrorUnclosedSection(t *testing.T) {
+	// Sections left open at the end are reported where they were opened
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "{{#a}}\n  {{^b}}\n{{/b}}\n")
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual(1, pe.Line)
+		test.AreEqual(1, pe.Col)
+		test.AreEqual(`section "a" is never closed`, pe.Msg)
+	})
+}
+
+func TestParseErrorMalformedTags(t *testing.T) {
+	// Malformed tags are reported rather than panicking
+
+	within(t, func(test *aTest) {
+		for _, source := range []string{
+			"{{}}", "{{ }}", "{{=}}", "{{==}}", "{{= =}}", "{{=a=b c=}}", "{{=<% %>}}",
+			"{{#}}", "{{/}}", "{{^}}", "{{>}}", "{{> * }}", "{{<}}", "{{$}}", "{{&}}",
+			"{{{}}}", "{{{ }}}", "{{a b}}", "{{#a b}}{{/a b}}", "x\n{{\n",
+		} {
+			_, err := Parse("test.mustache", source)
+			var pe *ParseError
+			test.IsTrue(errors.As(err, &pe), source, "gave", err)
+		}
+	})
+}
+
+func TestParseErrorsCollected(t *testing.T) {
+	// Parsing carries on after a problem so every problem is reported
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "{{#a}}{{}}\n{{#b}}{{#c}}{{/b}}\n{{=}}{{/x}}{{#d}}")
+		var errs ParseErrors
+		test.IsTrue(errors.As(err, &errs))
+
+		var msgs []string
+		for _, pe := range errs {
+			msgs = append(msgs, fmt.Sprintf("%d:%d %s", pe.Line, pe.Col, pe.Msg))
+		}
+		test.AreEqual(strings.Join([]string{
+			`1:1 section "a" is never closed`,
+			`1:7 empty tag`,
+			`2:13 closing tag for "b" does not match section "c" opened on line 2`,
+			`3:1 set delimiter tag must end with '='`,
+			`3:6 closing tag for "x" does not match section "a" opened on line 1`,
+			`3:12 section "d" is never closed`,
+		}, "\n"), strings.Join(msgs, "\n"))
+
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		test.AreEqual(errs[0], pe)
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"", "text", "{{a}}", "{{{a}}}", "{{&a}}", "{{#a}}{{b}}{{/a}}", "{{^a}}b{{/a}}",
+		"{{! comment }}", "{{!\nlong\ncomment\n}}", "{{>partial}}", "  {{>*dynamic}}\n",
+		"{{=<% %>=}}<%a%>", "{{<parent}}{{$block}}x{{/block}}{{/parent}}",
+		"{{}}", "{{=}}", "{{#}}", "{{", "}}{{", "{{{a}}",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		want, wantErr := Parse("fuzz.mustache", source)
+		got, err := ParseReader("fuzz.mustache", iotest.HalfReader(strings.NewReader(source)))
+		if fmt.Sprint(err) != fmt.Sprint(wantErr) || !reflect.DeepEqual(want, got) {
+			t.Errorf("ParseReader differs from Parse for %q", source)
+		}
+	})
+}
+
+func TestParseErrorsCapped(t *testing.T) {
+	// Only the first problems are reported, each on its own line
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", strings.Repeat("x {{}}\n", maxProblems*2))
+		var errs ParseErrors
+		test.IsTrue(errors.As(err, &errs))
+		test.AreEqual(maxProblems, len(errs))
+		for i, pe := range errs {
+			test.AreEqual(i+1, pe.Line)
+			test.AreEqual(3, pe.Col)
+		}
+	})
+}
+
+func TestParseErrorUnclosedComment(t *testing.T) {
+	// Multi-line comments left open are reported where they start
+
+	within(t, func(test *aTest) {
+		_, err := Parse("test.mustache", "Begin.\n  {{! this comment\nnever ends\n")
+		var pe *ParseError
+		test.IsTrue(errors.As(err, &pe))
+		if pe == nil {
+			return
+		}
+		test.AreEqual(2, pe.Line)
+		test.AreEqual(3, pe.Col)
+		test.AreEqual("{{! this comment", pe.Tag)
+		test.AreEqual(`comment is never closed, expected "}}"`, pe.Msg)
+	})
+}
+
+type failing struct{}
+
+func (failing) Fail() (string, error) {
+	return "", errors.New("failed")
+}
+
+func TestRenderErrorLocated(t *testing.T) {
+	// Execution errors are reported at the tag that failed
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		tmpl, err := ParseAST("test.mustache", "one\n  {{Fail}}")
+		test.IsNil(err)
+		for name, tree := range Lower(tmpl) {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		var l Locator
+		l.Add(tmpl)
+		err = l.Locate(t.ExecuteTemplate(new(bytes.Buffer), "test", failing{}))
+		var re *RenderError
+		test.IsTrue(errors.As(err, &re))
+		if re == nil {
+			return
+		}
+		test.AreEqual("test.mustache", re.Name)
+		test.AreEqual("test", re.Template)
+		test.AreEqual(2, re.Line)
+		test.AreEqual(3, re.Col)
+		test.AreEqual("{{Fail}}", re.Tag)
+		test.AreEqual("mussed: test.mustache:2:3: executing {{Fail}}: error calling mussedLookup: calling Fail: failed", re.Error())
+	})
+}
+
+func TestRenderErrorInSection(t *testing.T) {
+	// Failures inside sections name the template rather than the section
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		tmpl, err := ParseAST("test.mustache", "{{#s}}\n\t{{$b}}x{{/b}}\n{{/s}}")
+		test.IsNil(err)
+		for name, tree := range Lower(tmpl) {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		var l Locator
+		l.Add(tmpl)
+		err = l.Locate(t.ExecuteTemplate(new(bytes.Buffer), "test", map[string]interface{}{"s": true}))
+		var re *RenderError
+		test.IsTrue(errors.As(err, &re))
+		if re == nil {
+			return
+		}
+		test.AreEqual("test", re.Template)
+		test.AreEqual(2, re.Line)
+		test.AreEqual(2, re.Col)
+		test.AreEqual("{{$b}}", re.Tag)
+		test.IsTrue(errors.Is(err, errNotAttached))
+	})
+}
+
+func TestRenderErrorUnlocated(t *testing.T) {
+	// Errors that did not come from executing a tag are left alone
+
+	within(t, func(test *aTest) {
+		var l Locator
+		plain := errors.New("plain")
+		test.AreEqual(plain, l.Locate(plain))
+		test.IsNil(l.Locate(nil))
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html/template"
 	"reflect"
+	"strings"
 )
 
 var RequiredFuncs = template.FuncMap{
@@ -16,12 +17,66 @@ var RequiredFuncs = template.FuncMap{
 			return false
 		}
 	},
+	"mussedEscape": func(i interface{}) interface{} {
+		return i
+	},
 	"mussedUnescape": func(i ...interface{}) template.HTML {
-		if len(i) == 1 {
+		if len(i) == 1 && i[0] != nil {
 			return template.HTML(fmt.Sprint(i[0]))
 		}
 		return template.HTML("")
 	},
-	"mussedUpscope":   upscope,
-	"mussedDownscope": downscope,
+	"mussedLookup":         lookup,
+	"mussedUpscope":        upscope,
+	"mussedIsLambda":       isLambda,
+	"mussedOverride":       override,
+	"mussedAttached":       func() bool { return false },
+	"mussedEscapeFuncs":    func() template.FuncMap { return nil },
+	"mussedBlock":          notAttached,
+	"mussedPartial":        notAttached,
+	"mussedDynamicPartial": notAttached,
+}
+
+// MustacheEscaping escapes interpolated values exactly as mustache does,
+// replacing & " < and > with &amp; &quot; &lt; and &gt;, for templates
+// executed with text/template, where it is the only escaping applied.
+// Install it after RequiredFuncs:
+//
+//	t := texttemplate.New("page").
+//		Funcs(texttemplate.FuncMap(RequiredFuncs)).
+//		Funcs(texttemplate.FuncMap(MustacheEscaping))
+//
+// Section lambdas are then rendered with text/template as well. It is not
+// meant for html/template, which escapes values for the context they are
+// in, so values it escaped would be escaped again in URLs and scripts.
+var MustacheEscaping = template.FuncMap{
+	"mussedEscape": escapeMustache,
+}
+
+var mustacheReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	`"`, "&quot;",
+	"<", "&lt;",
+	">", "&gt;",
+)
+
+// escapeMustache escapes i as mustache does. Like html/template it prints
+// nothing for nil and leaves template.HTML as it is.
+func escapeMustache(i interface{}) string {
+	switch i := i.(type) {
+	case nil:
+		return ""
+	case template.HTML:
+		return string(i)
+	}
+	return mustacheReplacer.Replace(fmt.Sprint(i))
+}
+
+// the lambda renderers execute templates using RequiredFuncs, and section
+// lambdas are handed MustacheEscaping by itself, so they are added here to
+// avoid an initialization cycle
+func init() {
+	RequiredFuncs["mussedLambda"] = interpolateLambda
+	RequiredFuncs["mussedSectionLambda"] = sectionLambda
+	MustacheEscaping["mussedEscapeFuncs"] = func() template.FuncMap { return MustacheEscaping }
 }
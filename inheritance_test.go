@@ -0,0 +1,754 @@
+package mussed
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"testing"
+)
+
+/*
+Like partials, Parent tags are used to expand an external template into the
+current template. Unlike partials, Parent tags may contain optional
+arguments delimited by Block tags. For this reason, Parent tags may also be
+referred to as Parametric Partials.
+
+The Parent tags' content MUST be a non-whitespace character sequence NOT
+containing the current closing delimiter; each Parent tag MUST be followed
+by an End Section tag with the same content within the matching Parent tag.
+
+Block tags are used inside of parent tags to assign data onto the context
+stack prior to rendering the parent template. Outside of parent tags, Block
+tags are used to indicate where value set in the parent tag should be
+placed. If no value is set then the content in between the Block tags, if
+any, is rendered.
+
+Parent and Block tags SHOULD be treated as standalone when appropriate.
+
+*/
+
+func TestINHERITANCE0(t *testing.T) {
+	// Default
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$title}}Default title{{/title}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Default title
+`, b.String())
+	})
+}
+
+func TestINHERITANCE1(t *testing.T) {
+	// Variable
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$foo}}default {{bar}} content{{/foo}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"bar":"baz"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default baz content
+`, b.String())
+	})
+}
+
+func TestINHERITANCE2(t *testing.T) {
+	// Triple Mustache
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$foo}}default {{{bar}}} content{{/foo}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"bar":"<baz>"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default <baz> content
+`, b.String())
+	})
+}
+
+func TestINHERITANCE3(t *testing.T) {
+	// Sections
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$foo}}default {{#bar}}{{baz}}{{/bar}} content{{/foo}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"bar":{"baz":"qux"}}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default qux content
+`, b.String())
+	})
+}
+
+func TestINHERITANCE4(t *testing.T) {
+	// Negative Sections
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$foo}}default {{^bar}}{{baz}}{{/bar}} content{{/foo}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"baz":"three"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default three content
+`, b.String())
+	})
+}
+
+func TestINHERITANCE5(t *testing.T) {
+	// Mustache Injection
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{$foo}}default {{#bar}}{{baz}}{{/bar}} content{{/foo}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"bar":{"baz":"{{qux}}"}}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default {{qux}} content
+`, b.String())
+	})
+}
+
+func TestINHERITANCE6(t *testing.T) {
+	// Inherit
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<include}}{{/include}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("include.mustache", `{{$foo}}default content{{/foo}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default content`, b.String())
+	})
+}
+
+func TestINHERITANCE7(t *testing.T) {
+	// Overridden Content
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<super}}{{$title}}sub template title{{/title}}{{/super}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("super.mustache", `...{{$title}}Default title{{/title}}...`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`...sub template title...`, b.String())
+	})
+}
+
+func TestINHERITANCE8(t *testing.T) {
+	// Data Does Not Override Block
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<include}}{{$var}}var in template{{/var}}{{/include}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("include.mustache", `{{$var}}var in include{{/var}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"var":"var in data"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`var in template`, b.String())
+	})
+}
+
+func TestINHERITANCE9(t *testing.T) {
+	// Data Does Not Override Block Default
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<include}}{{/include}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("include.mustache", `{{$var}}var in include{{/var}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"var":"var in data"}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`var in include`, b.String())
+	})
+}
+
+func TestINHERITANCE10(t *testing.T) {
+	// Overridden Parent
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `test {{<parent}}{{$stuff}}override{{/stuff}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$stuff}}...{{/stuff}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`test override`, b.String())
+	})
+}
+
+func TestINHERITANCE11(t *testing.T) {
+	// Two Overridden Parents
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `test {{<parent}}{{$stuff}}override1{{/stuff}}{{/parent}} {{<parent}}{{$stuff}}override2{{/stuff}}{{/parent}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `|{{$stuff}}...{{/stuff}}{{$default}} default{{/default}}|`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`test |override1 default| |override2 default|
+`, b.String())
+	})
+}
+
+func TestINHERITANCE12(t *testing.T) {
+	// Only One Override
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$stuff2}}override two{{/stuff2}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$stuff}}new default one{{/stuff}}, {{$stuff2}}new default two{{/stuff2}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`new default one, override two`, b.String())
+	})
+}
+
+func TestINHERITANCE13(t *testing.T) {
+	// Parent Template
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{>parent}}|{{<parent}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$foo}}default content{{/foo}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default content|default content`, b.String())
+	})
+}
+
+func TestINHERITANCE14(t *testing.T) {
+	// Recursion
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$foo}}override{{/foo}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$foo}}default content{{/foo}} {{$bar}}{{<parent2}}{{/parent2}}{{/bar}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent2.mustache", `{{$foo}}parent2 default content{{/foo}} {{<parent}}{{$bar}}don't recurse{{/bar}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`override override override don't recurse`, b.String())
+	})
+}
+
+func TestINHERITANCE15(t *testing.T) {
+	// Multi-level Inheritance
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$a}}c{{/a}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("grandParent.mustache", `{{$a}}g{{/a}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("older.mustache", `{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{<older}}{{$a}}p{{/a}}{{/older}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`c`, b.String())
+	})
+}
+
+func TestINHERITANCE16(t *testing.T) {
+	// Multi-level Inheritance, No Sub Child
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("grandParent.mustache", `{{$a}}g{{/a}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("older.mustache", `{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{<older}}{{$a}}p{{/a}}{{/older}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`p`, b.String())
+	})
+}
+
+func TestINHERITANCE17(t *testing.T) {
+	// Text Inside Parent
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}} asdfasd {{$foo}}hmm{{/foo}} asdfasdfasdf {{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$foo}}default content{{/foo}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`hmm`, b.String())
+	})
+}
+
+func TestINHERITANCE18(t *testing.T) {
+	// Text Inside Parent
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}} asdfasd asdfasdfasdf {{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$foo}}default content{{/foo}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`default content`, b.String())
+	})
+}
+
+func TestINHERITANCE19(t *testing.T) {
+	// Block Scope
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$block}}I say {{fruit}}.{{/block}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{#nested}}{{$block}}You say {{fruit}}.{{/block}}{{/nested}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"fruit":"apples","nested":{"fruit":"bananas"}}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`I say bananas.`, b.String())
+	})
+}
+
+func TestINHERITANCE20(t *testing.T) {
+	// Standalone Parent
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `Hi,
+  {{<parent}}{{/parent}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `one
+two
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hi,
+  one
+  two
+`, b.String())
+	})
+}
+
+func TestINHERITANCE21(t *testing.T) {
+	// Standalone Block
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$block}}
+one
+two{{/block}}
+{{/parent}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `Hi,
+  {{$block}}{{/block}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hi,
+  one
+  two
+`, b.String())
+	})
+}
+
+func TestINHERITANCE22(t *testing.T) {
+	// Block Reindentation
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$block}}
+    one
+    two
+{{/block}}{{/parent}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `Hi,
+  {{$block}}
+  {{/block}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hi,
+  one
+  two
+`, b.String())
+	})
+}
+
+func TestINHERITANCE23(t *testing.T) {
+	// Intrinsic Indentation
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$block}}
+one
+two
+{{/block}}{{/parent}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `Hi,
+{{$block}}
+    default
+{{/block}}
+`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hi,
+one
+two
+`, b.String())
+	})
+}
+
+func TestINHERITANCE24(t *testing.T) {
+	// Override Parent With Newlines
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		trees, err := Parse("test.mustache", `{{<parent}}{{$ballmer}}
+peaked
+
+:(
+{{/ballmer}}{{/parent}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		trees, err = Parse("parent.mustache", `{{$ballmer}}peaking{{/ballmer}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`peaked
+
+:(
+`, b.String())
+	})
+}
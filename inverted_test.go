@@ -426,10 +426,7 @@ func TestINVERTED17(t *testing.T) {
 
 	within(t, func(test *aTest) {
 		t := template.New("test").Funcs(RequiredFuncs)
-		trees, err := Parse("test.mustache", `|
-{{^boolean}}
-{{/boolean}}
-|`)
+		trees, err := Parse("test.mustache", "|\r\n{{^boolean}}\r\n{{/boolean}}\r\n|")
 		test.IsNil(err)
 		for name, tree := range trees {
 			t, err = t.AddParseTree(name, tree)
@@ -440,8 +437,7 @@ func TestINVERTED17(t *testing.T) {
 		test.IsNil(json.Unmarshal([]byte(`{"boolean":false}`), &data))
 		b := new(bytes.Buffer)
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
-		test.AreEqual(`|
-|`, b.String())
+		test.AreEqual("|\r\n|", b.String())
 	})
 }
 
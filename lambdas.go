@@ -0,0 +1,148 @@
+package mussed
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strconv"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// isLambda reports whether a section value should be treated as a section
+// lambda rather than as data.
+func isLambda(i interface{}) bool {
+	_, ok := i.(func(string) string)
+	return ok
+}
+
+// interpolateLambda calls interpolation lambdas and renders their result
+// against left and right, the default delimiters of the template. Values
+// that are not lambdas are returned unchanged so they can be escaped or
+// printed as normal, apart from having their line breaks marked inside
+// indented partials.
+func interpolateLambda(ctx interface{}, left, right string, i interface{}) (interface{}, error) {
+	lambda, ok := i.(func() string)
+	if !ok {
+		return markLines(ctx, i), nil
+	}
+	s, err := renderLambda(ctx, lambda(), left, right, nil)
+	return markLines(ctx, s), err
+}
+
+// sectionLambda hands the unprocessed section text to a section lambda and
+// renders the result against the delimiters in effect at the section tag.
+// When the caller escapes with escaping, a text/template set with
+// MustacheEscaping, the result is rendered with text/template and escaping
+// too. The result is rendered in a set of its own, so partials and parents
+// in it are only found when the caller's set was attached, see
+// runner.sectionLambda.
+func sectionLambda(ctx, i interface{}, raw, left, right string, escaping template.FuncMap) (template.HTML, error) {
+	return (*runner)(nil).sectionLambda(ctx, i, raw, left, right, escaping)
+}
+
+// sectionLambda renders a section lambda like sectionLambda, with r, when
+// it is not nil, rendering the partials and parents called by the result.
+// These are templates of r's set that the result's own set calls through
+// stand-ins: html/template takes no new templates into a set once it has
+// executed, so the result cannot be added to r's set instead.
+func (r *runner) sectionLambda(ctx, i interface{}, raw, left, right string, escaping template.FuncMap) (template.HTML, error) {
+	lambda, ok := i.(func(string) string)
+	if !ok {
+		return "", fmt.Errorf("mussed: %T is not a section lambda", i)
+	}
+	if escaping != nil {
+		s, err := renderLambda(ctx, lambda(raw), left, right, escaping)
+		return template.HTML(s), err
+	}
+
+	p := &Parser{LeftDelim: left, RightDelim: right}
+	trees, err := p.Parse("mussedLambda.mustache", lambda(raw))
+	if err != nil {
+		return "", err
+	}
+	t := template.New("mussedLambda").Funcs(RequiredFuncs)
+	if r != nil {
+		t.Funcs((&runner{set: t, parent: r}).funcs())
+	}
+	for name, tree := range trees {
+		if t, err = t.AddParseTree(name, tree); err != nil {
+			return "", err
+		}
+	}
+	if r != nil {
+		if err = r.standIns(t, trees); err != nil {
+			return "", err
+		}
+	}
+	b := new(bytes.Buffer)
+	if err = t.ExecuteTemplate(b, "mussedLambda", ctx); err != nil {
+		return "", err
+	}
+	return template.HTML(b.String()), nil
+}
+
+// renderLambda renders lambda output with text/template, escaping values
+// with escaping. Interpolation lambdas pass none, as the interpolation tag
+// the lambda was found in does the escaping.
+func renderLambda(ctx interface{}, text, left, right string, escaping template.FuncMap) (string, error) {
+	p := &Parser{LeftDelim: left, RightDelim: right}
+	trees, err := p.Parse("mussedLambda.mustache", text)
+	if err != nil {
+		return "", err
+	}
+	t := texttemplate.New("mussedLambda").
+		Funcs(texttemplate.FuncMap(RequiredFuncs)).
+		Funcs(texttemplate.FuncMap(escaping))
+	for name, tree := range trees {
+		if t, err = t.AddParseTree(name, tree); err != nil {
+			return "", err
+		}
+	}
+	b := new(bytes.Buffer)
+	if err = t.ExecuteTemplate(b, "mussedLambda", ctx); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// standIns adds a template to t for each template of r's set that trees
+// call, which executes it in r's set.
+func (r *runner) standIns(t *template.Template, trees map[string]*parse.Tree) error {
+	called := make(map[string]bool)
+	for _, tree := range trees {
+		calledTemplates(tree.Root, called)
+	}
+	t.Funcs(template.FuncMap{"mussedStandIn": r.execute})
+	for name := range called {
+		if trees[name] != nil || !r.defines(name) {
+			continue
+		}
+		if _, err := t.New(name).Parse("{{mussedStandIn " + strconv.Quote(name) + " .}}"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// calledTemplates adds the names of the templates n calls to called.
+func calledTemplates(n parse.Node, called map[string]bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		for _, n := range n.Nodes {
+			calledTemplates(n, called)
+		}
+	case *parse.IfNode:
+		calledTemplates(n.List, called)
+		if n.ElseList != nil {
+			calledTemplates(n.ElseList, called)
+		}
+	case *parse.RangeNode:
+		calledTemplates(n.List, called)
+		if n.ElseList != nil {
+			calledTemplates(n.ElseList, called)
+		}
+	case *parse.TemplateNode:
+		called[n.Name] = true
+	}
+}
@@ -0,0 +1,245 @@
+package mussed
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"strconv"
+	"testing"
+)
+
+/*
+Lambdas are a special-cased data type for use in interpolations and
+sections.
+
+When used as the data value for an Interpolation tag, the lambda MUST be
+treatable as an arity 0 function, and invoked as such.  The returned value
+MUST be rendered against the default delimiters, then interpolated in place
+of the lambda.
+
+When used as the data value for a Section tag, the lambda MUST be treatable
+as an arity 1 function, and invoked as such (passing a String containing the
+unprocessed section contents).  The returned value MUST be rendered against
+the current delimiters, then interpolated in place of the section.
+
+*/
+
+func TestLAMBDAS0(t *testing.T) {
+	// Interpolation
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `Hello, {{lambda}}!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		data["lambda"] = func() string { return "world" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hello, world!`, b.String())
+	})
+}
+
+func TestLAMBDAS1(t *testing.T) {
+	// Interpolation - Expansion
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `Hello, {{lambda}}!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"planet":"world"}`), &data))
+		data["lambda"] = func() string { return "{{planet}}" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hello, world!`, b.String())
+	})
+}
+
+func TestLAMBDAS2(t *testing.T) {
+	// Interpolation - Alternate Delimiters
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{= | | =}}
+Hello, (|&lambda|)!`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"planet":"world"}`), &data))
+		data["lambda"] = func() string { return "|planet| => {{planet}}" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hello, (|planet| => world)!`, b.String())
+	})
+}
+
+func TestLAMBDAS3(t *testing.T) {
+	// Interpolation - Multiple Calls
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{lambda}} == {{{lambda}}} == {{lambda}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		calls := 0
+		data["lambda"] = func() string {
+			calls++
+			return strconv.Itoa(calls)
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`1 == 2 == 3`, b.String())
+	})
+}
+
+func TestLAMBDAS4(t *testing.T) {
+	// Escaping
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `<{{lambda}}{{{lambda}}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		data["lambda"] = func() string { return ">" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`&lt;&gt;>`, b.String())
+	})
+}
+
+func TestLAMBDAS5(t *testing.T) {
+	// Section
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `<{{#lambda}}{{x}}{{/lambda}}>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"x":"Error!"}`), &data))
+		data["lambda"] = func(text string) string {
+			if text == "{{x}}" {
+				return "yes"
+			}
+			return "no"
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`&lt;yes>`, b.String())
+	})
+}
+
+func TestLAMBDAS6(t *testing.T) {
+	// Section - Expansion
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `<{{#lambda}}-{{/lambda}}>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"planet":"Earth"}`), &data))
+		data["lambda"] = func(text string) string { return text + "{{planet}}" + text }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`&lt;-Earth->`, b.String())
+	})
+}
+
+func TestLAMBDAS7(t *testing.T) {
+	// Section - Alternate Delimiters
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{= | | =}}<|#lambda|-|/lambda|>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"planet":"Earth"}`), &data))
+		data["lambda"] = func(text string) string { return text + "{{planet}} => |planet|" + text }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`&lt;-{{planet}} => Earth->`, b.String())
+	})
+}
+
+func TestLAMBDAS8(t *testing.T) {
+	// Section - Multiple Calls
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#lambda}}FILE{{/lambda}} != {{#lambda}}LINE{{/lambda}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
+		data["lambda"] = func(text string) string { return "__" + text + "__" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`__FILE__ != __LINE__`, b.String())
+	})
+}
+
+func TestLAMBDAS9(t *testing.T) {
+	// Inverted Section
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `<{{^lambda}}{{static}}{{/lambda}}>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"static":"static"}`), &data))
+		data["lambda"] = func(text string) string { return "" }
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`&lt;>`, b.String())
+	})
+}
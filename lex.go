@@ -0,0 +1,467 @@
+package mussed
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// item is a piece of the template source found by the lexer.
+type item struct {
+	typ  itemType
+	pos  int    // offset of the text or tag in the source
+	val  string // the text, or the tag including its delimiters
+	line int    // 1 based line of pos
+
+	// from and to bound the source the item took up, which for a
+	// standalone tag includes its indentation and line break, and indent
+	// is the indentation of a standalone tag.
+	from, to int
+	indent   string
+}
+
+type itemType int
+
+const (
+	itemError itemType = iota // a tag that is never closed, val runs to the end of its line
+	itemEOF
+	itemText
+	itemTag
+)
+
+// stateFn is a state of the lexer, returning the next state.
+type stateFn func(*lexer) stateFn
+
+// lexer splits a template into text and tags in a single pass over the
+// source, following set delimiter tags as it finds them. Like the lexer of
+// text/template/parse it runs a state machine, with the parser asking for
+// one item at a time. The source can be read a line at a time as the
+// lexer needs it.
+type lexer struct {
+	input       string
+	lines       *bufio.Scanner // the rest of the source, nil once read
+	read        strings.Builder
+	streamed    bool  // the source is read from lines, see keep
+	err         error // the error reading the source
+	parser      *Parser
+	left        string
+	right       string
+	leftEscape  string
+	rightEscape string
+	state       stateFn
+	begin       int    // start of the template, after any byte order mark
+	start       int    // start of the text not yet emitted
+	pos         int    // offset of the tag being lexed
+	escaped     bool   // the tag being lexed uses the escape delimiters
+	leftAt      int    // offset of the next left delimiter, -1 for none
+	opened      []byte // sigils of the sections, parents and blocks open
+	item        item
+	emitted     bool
+	linePos     int
+	line        int
+
+	// a line of parent and block tags that is standalone as a whole, see
+	// group, runs to groupEnd, with its first and last tags at groupFirst
+	// and groupLast
+	groupFirst, groupLast, groupEnd int
+}
+
+func lex(input string, p *Parser) *lexer {
+	l := &lexer{
+		input:  input,
+		parser: p,
+		left:   p.LeftDelim,
+		right:  p.RightDelim,
+		state:  lexText,
+		leftAt: -2,
+		line:   1,
+	}
+	l.leftEscape, l.rightEscape = p.escapeDelims(l.left, l.right)
+	if p.StripBOM {
+		l.state = lexBOM
+	}
+	return l
+}
+
+// lexLines returns a lexer reading the source from r, a line at a time
+// as the tags found so far need it.
+func lexLines(r io.Reader, p *Parser) *lexer {
+	l := lex("", p)
+	l.streamed = true
+	l.lines = bufio.NewScanner(r)
+	l.lines.Buffer(nil, int(^uint(0)>>1))
+	l.lines.Split(scanLines)
+	return l
+}
+
+// fill reads another line of the source, reporting whether there was one.
+func (l *lexer) fill() bool {
+	if l.lines == nil {
+		return false
+	}
+	if !l.lines.Scan() {
+		l.err = l.lines.Err()
+		l.lines = nil
+		return false
+	}
+	l.read.Write(l.lines.Bytes())
+	l.input = l.read.String()
+	return true
+}
+
+// find returns the offset of the first s at or after from, reading more
+// of the source until one is found or the source runs out.
+func (l *lexer) find(from int, s string) int {
+	for {
+		if i := strings.Index(l.input[from:], s); i >= 0 {
+			return from + i
+		}
+		// only new text needs searching, along with the end of the old
+		// text in case s is split between them
+		if next := len(l.input) - len(s) + 1; next > from {
+			from = next
+		}
+		if !l.fill() {
+			return -1
+		}
+	}
+}
+
+// nextItem returns the next item of the template, an itemEOF once the
+// template is exhausted.
+func (l *lexer) nextItem() item {
+	l.emitted = false
+	for !l.emitted {
+		l.state = l.state(l)
+	}
+	return l.item
+}
+
+func (l *lexer) emit(typ itemType, pos int, val string, from, to int) {
+	l.item = item{typ: typ, pos: pos, val: l.keep(val), line: l.lineOf(pos), from: from, to: to}
+	l.emitted = true
+}
+
+// keep returns s, part of the source, to be kept after the lexer is done.
+// A source read from a reader is copied into a larger buffer each time the
+// buffer holding it fills up, so s is copied rather than keeping the buffer
+// it is in alive.
+func (l *lexer) keep(s string) string {
+	if l.streamed {
+		return strings.Clone(s)
+	}
+	return s
+}
+
+// lineOf returns the 1 based line of offset pos, counting on from the last
+// offset asked about as items are found in order.
+func (l *lexer) lineOf(pos int) int {
+	if pos < l.linePos {
+		l.linePos, l.line = 0, 1
+	}
+	l.line += strings.Count(l.input[l.linePos:pos], "\n")
+	l.linePos = pos
+	return l.line
+}
+
+// bom is the UTF-8 byte order mark.
+const bom = "\xef\xbb\xbf"
+
+// lexBOM skips a byte order mark at the start of the source, which is then
+// left out of the text but still counted in offsets.
+func lexBOM(l *lexer) stateFn {
+	for len(l.input) < len(bom) && l.fill() {
+	}
+	if strings.HasPrefix(l.input, bom) {
+		l.begin, l.start = len(bom), len(bom)
+	}
+	return lexText
+}
+
+// lexText finds the next tag, emitting the text before it.
+func lexText(l *lexer) stateFn {
+	l.leftAt = l.next(l.leftAt, l.left)
+	normal, escape := l.leftAt, -1
+	switch {
+	case l.leftEscape == "":
+	case normal < 0:
+		escape = l.find(l.start, l.leftEscape)
+	default:
+		// an escape delimiter is only used when it starts no later than
+		// the left delimiter, so there is no need to look further
+		end := normal + len(l.leftEscape)
+		for end > len(l.input) && l.fill() {
+		}
+		if end > len(l.input) {
+			end = len(l.input)
+		}
+		if i := strings.Index(l.input[l.start:end], l.leftEscape); i >= 0 {
+			escape = l.start + i
+		}
+	}
+	switch {
+	case escape >= 0 && (normal < 0 || escape <= normal):
+		l.pos, l.escaped = escape, true
+	case normal >= 0:
+		l.pos, l.escaped = normal, false
+	default:
+		if l.start < len(l.input) {
+			l.emit(itemText, l.start, l.input[l.start:], l.start, len(l.input))
+			l.start = len(l.input)
+			return lexEOF
+		}
+		return lexEOF(l)
+	}
+
+	end := l.pos
+	if from, _, ok := l.standalone(); ok {
+		end = from
+	}
+	if end > l.start {
+		l.emit(itemText, l.start, l.input[l.start:end], l.start, end)
+	}
+	return lexTag
+}
+
+// lexTag emits the tag found by lexText.
+func lexTag(l *lexer) stateFn {
+	closeAt := l.closing()
+	if closeAt < 0 {
+		val := l.input[l.pos:]
+		if nl := strings.IndexByte(val, '\n'); nl >= 0 {
+			val = val[:nl]
+		}
+		l.emit(itemError, l.pos, val, l.pos, len(l.input))
+		return lexEOF
+	}
+
+	from, to, standalone := l.standalone()
+	if !standalone {
+		from, to = l.pos, closeAt
+	}
+	l.emit(itemTag, l.pos, l.input[l.pos:closeAt], from, to)
+	if standalone && (from == l.begin || l.input[from-1] == '\n') {
+		l.item.indent = l.keep(l.input[from:l.pos])
+	}
+	l.start = to
+
+	if l.escaped {
+		return lexText
+	}
+	switch sigil := l.sigil(); sigil {
+	case '=':
+		if left, right, ok := parseDelimiters(l.inner(closeAt)); ok {
+			l.left, l.right = left, right
+			l.leftEscape, l.rightEscape = l.parser.escapeDelims(left, right)
+			l.leftAt = -2
+		}
+	case '#', '^', '<', '$':
+		l.opened = append(l.opened, sigil)
+	case '/':
+		if len(l.opened) > 0 {
+			l.opened = l.opened[:len(l.opened)-1]
+		}
+	}
+	return lexText
+}
+
+// next returns the offset of the first delim at or after the text not yet
+// emitted, given at, where it was last found. Delimiters are only searched
+// for again once passed, so a delimiter far ahead or missing altogether
+// does not make every tag search to the end of the source.
+func (l *lexer) next(at int, delim string) int {
+	if at == -1 || at >= l.start {
+		return at
+	}
+	return l.find(l.start, delim)
+}
+
+func lexEOF(l *lexer) stateFn {
+	l.emit(itemEOF, len(l.input), "", len(l.input), len(l.input))
+	return lexEOF
+}
+
+// closing returns the offset just after the end of the tag being lexed,
+// or -1 when it is never closed.
+func (l *lexer) closing() int {
+	left, right := l.left, l.right
+	if l.escaped {
+		left, right = l.leftEscape, l.rightEscape
+	}
+	at := l.find(l.pos+len(left), right)
+	if at < 0 {
+		return -1
+	}
+	return at + len(right)
+}
+
+// inner returns the trimmed text between the delimiters of the tag being
+// lexed, which ends at closeAt.
+func (l *lexer) inner(closeAt int) string {
+	return strings.TrimSpace(l.input[l.pos+len(l.left) : closeAt-len(l.right)])
+}
+
+// sigil returns the first character inside the tag being lexed, or 0.
+func (l *lexer) sigil() byte {
+	return l.sigilAt(l.pos)
+}
+
+// sigilAt returns the first character inside the tag at pos, or 0.
+func (l *lexer) sigilAt(pos int) byte {
+	inner := strings.TrimLeft(l.input[pos+len(l.left):], " \t\r\n")
+	if inner == "" {
+		return 0
+	}
+	return inner[0]
+}
+
+// standalone reports whether the tag being lexed is alone on its line, or
+// lines, and is of a kind that mustache then removes the line of. It
+// returns the start of the tag's first line and the offset after its last
+// line break, which is either \n or \r\n. The tags of a line of parent and
+// block tags, see group, are standalone together: the first takes the
+// indentation, the last the line break and the rest the space between.
+func (l *lexer) standalone() (from, to int, ok bool) {
+	if l.escaped {
+		return 0, 0, false
+	}
+	closeAt := l.closing()
+	if closeAt < 0 {
+		return 0, 0, false
+	}
+	if l.pos < l.groupEnd && l.pos != l.groupFirst {
+		if l.pos == l.groupLast {
+			return l.start, l.groupEnd, true
+		}
+		return l.start, closeAt, true
+	}
+	switch l.sigil() {
+	case '#', '/', '^', '<', '$', '=', '!', '>':
+	default:
+		return 0, 0, false
+	}
+
+	// only the whitespace around the tag is looked at, so long lines
+	// holding many tags are not scanned again for each one
+	from = l.pos
+	for from > l.begin && isSpace(l.input[from-1]) {
+		from--
+	}
+	if from > l.begin && l.input[from-1] != '\n' {
+		return 0, 0, false
+	}
+	if l.pos == l.groupFirst && l.pos < l.groupEnd {
+		return from, closeAt, true
+	}
+	if to, ok = l.lineEnd(closeAt); ok {
+		return from, to, true
+	}
+	if end, last, ok := l.group(closeAt); ok {
+		l.groupFirst, l.groupLast, l.groupEnd = l.pos, last, end
+		return from, closeAt, true
+	}
+	return 0, 0, false
+}
+
+// lineEnd reports whether only spaces and tabs follow offset at on its
+// line, returning the offset after the line break, if there is one.
+func (l *lexer) lineEnd(at int) (int, bool) {
+	for {
+		for at < len(l.input) && isSpace(l.input[at]) {
+			at++
+		}
+		// a \r needs the next byte to tell whether it ends the line
+		if at+1 < len(l.input) || at < len(l.input) && l.input[at] != '\r' || !l.fill() {
+			break
+		}
+	}
+	switch {
+	case at == len(l.input):
+	case l.input[at] == '\n':
+		at++
+	case strings.HasPrefix(l.input[at:], "\r\n"):
+		at += 2
+	default:
+		return 0, false
+	}
+	return at, true
+}
+
+// group reports whether the tag being lexed, which ends at closeAt, starts
+// a line of nothing but two or more parent and block tags, opening ones or
+// ones closing them, such as {{<parent}}{{/parent}} or {{/block}}{{/parent}}.
+// Mustache treats such a line as standalone, except for a block opened and
+// closed on it, which renders its content there. It returns the end of the
+// line and the offset of its last tag.
+func (l *lexer) group(closeAt int) (end, last int, ok bool) {
+	opened := append([]byte(nil), l.opened...)
+	var sigils []byte
+	for at := l.pos; ; {
+		switch sigil := l.sigilAt(at); sigil {
+		case '<', '$':
+			opened = append(opened, sigil)
+			sigils = append(sigils, sigil)
+		case '/':
+			if len(opened) == 0 || opened[len(opened)-1] != '<' && opened[len(opened)-1] != '$' {
+				return 0, 0, false
+			}
+			opened = opened[:len(opened)-1]
+			sigils = append(sigils, sigil)
+		default:
+			return 0, 0, false
+		}
+		last = at
+
+		if end, ok := l.lineEnd(closeAt); ok {
+			if len(sigils) < 2 || string(sigils) == "$/" {
+				return 0, 0, false
+			}
+			return end, last, true
+		}
+		at = closeAt
+		for at < len(l.input) && isSpace(l.input[at]) {
+			at++
+		}
+		if !strings.HasPrefix(l.input[at:], l.left) ||
+			l.leftEscape != "" && strings.HasPrefix(l.input[at:], l.leftEscape) {
+			return 0, 0, false
+		}
+		closeAt = l.find(at+len(l.left), l.right)
+		if closeAt < 0 {
+			return 0, 0, false
+		}
+		closeAt += len(l.right)
+	}
+}
+
+// escapeDelims returns the escape delimiters in effect under the
+// delimiters left and right, or empty strings when there are none. Like the
+// triple mustache, which the spec only has with {{ and }}, they go with the
+// Parser's own delimiters and only when they wrap them, so set delimiter
+// tags switch them off until the Parser's delimiters are set again.
+func (p *Parser) escapeDelims(left, right string) (leftEscape, rightEscape string) {
+	if left != p.LeftDelim || right != p.RightDelim ||
+		!strings.HasPrefix(p.LeftEscapeDelim, left) ||
+		!strings.HasSuffix(p.RightEscapeDelim, right) {
+		return "", ""
+	}
+	return p.LeftEscapeDelim, p.RightEscapeDelim
+}
+
+// isSpace reports whether c is whitespace within a line.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// parseDelimiters returns the delimiters a set delimiter tag, with inner the
+// trimmed text between its delimiters, switches to.
+func parseDelimiters(inner string) (left, right string, ok bool) {
+	if len(inner) < 2 || inner[0] != '=' || inner[len(inner)-1] != '=' {
+		return "", "", false
+	}
+	delims := strings.Fields(inner[1 : len(inner)-1])
+	if len(delims) != 2 || strings.Contains(delims[0]+delims[1], "=") {
+		return "", "", false
+	}
+	return delims[0], delims[1], true
+}
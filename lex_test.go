@@ -0,0 +1,202 @@
+package mussed
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template/parse"
+)
+
+func lexAll(source string) []item {
+	l := lex(source, NewParser())
+	var items []item
+	for {
+		it := l.nextItem()
+		items = append(items, it)
+		if it.typ == itemEOF || it.typ == itemError {
+			return items
+		}
+	}
+}
+
+func TestLexItems(t *testing.T) {
+	// Text and tags come out in order, located in the source
+
+	within(t, func(test *aTest) {
+		items := lexAll("a {{b}}\n  {{#c}}\n{{{d}}}{{=<% %>=}}<%e%>")
+		var got []string
+		for _, it := range items {
+			got = append(got, fmt.Sprintf("%d:%d:%q", it.typ, it.line, it.val))
+		}
+		test.AreEqual([]string{
+			fmt.Sprintf("%d:1:%q", itemText, "a "),
+			fmt.Sprintf("%d:1:%q", itemTag, "{{b}}"),
+			fmt.Sprintf("%d:1:%q", itemText, "\n"),
+			fmt.Sprintf("%d:2:%q", itemTag, "{{#c}}"),
+			fmt.Sprintf("%d:3:%q", itemTag, "{{{d}}}"),
+			fmt.Sprintf("%d:3:%q", itemTag, "{{=<% %>=}}"),
+			fmt.Sprintf("%d:3:%q", itemTag, "<%e%>"),
+			fmt.Sprintf("%d:3:%q", itemEOF, ""),
+		}, got)
+
+		section := items[3]
+		test.AreEqual("  ", section.indent)
+		test.AreEqual(8, section.from)
+		test.AreEqual(17, section.to)
+	})
+}
+
+func TestLexStandalone(t *testing.T) {
+	// Only tags alone on their lines take the whole line with them
+
+	within(t, func(test *aTest) {
+		for source, standalone := range map[string]bool{
+			"  {{#a}}  \n":    true,
+			"\t{{/a}}":        true,
+			"{{! a\nb }}\r\n": true,
+			"{{>a}}\n":        true,
+			"  {{^a}}\r\n":    true,
+			"  {{=<% %>=}}":   true,
+			" {{$a}} \t":      true,
+			"x {{#a}}\n":      false,
+			"{{#a}} x\n":      false,
+			"{{#a}}{{/a}}\n":  false,
+			"  {{a}}\n":       false,
+			"  {{{a}}}\n":     false,
+			"{{#a}}\rx\n":     false,
+		} {
+			for _, it := range lexAll(source) {
+				if it.typ == itemTag {
+					test.AreEqual(standalone, it.from == 0 && it.to == len(source), source)
+					break
+				}
+			}
+		}
+	})
+}
+
+func TestLexStandaloneGroup(t *testing.T) {
+	// A line of parent and block tags is standalone as a whole, unless it
+	// opens and closes a block
+
+	within(t, func(test *aTest) {
+		for source, standalone := range map[string]bool{
+			"  {{<p}}{{/p}}\n":           true,
+			"{{<p}} {{$b}}\n":            true,
+			"{{<p}}{{$b}}{{/b}}{{/p}}\n": true,
+			"{{$b}}{{/b}}\n":             false,
+			"{{<p}}{{#a}}\n":             false,
+			"{{<p}}{{/p}}x\n":            false,
+			"{{<p}}{{{a}}}\n":            false,
+		} {
+			var text bool
+			for _, it := range lexAll(source) {
+				text = text || it.typ == itemText
+			}
+			test.AreEqual(standalone, !text, source)
+		}
+
+		items := lexAll("x\n  {{<p}} {{/p}}\ny")
+		test.AreEqual("  ", items[1].indent)
+		test.AreEqual(2, items[1].from)
+		test.AreEqual("", items[2].indent)
+		test.AreEqual(len("x\n  {{<p}} {{/p}}\n"), items[2].to)
+	})
+}
+
+func TestLexUnterminated(t *testing.T) {
+	// A tag that is never closed ends lexing with an error item
+
+	within(t, func(test *aTest) {
+		items := lexAll("a {{b\nc")
+		last := items[len(items)-1]
+		test.AreEqual(itemError, last.typ)
+		test.AreEqual("{{b", last.val)
+		test.AreEqual(2, last.pos)
+	})
+}
+
+// benchmarkSource repeats a template mixing text, sections, comments and
+// interpolations until it is at least size bytes.
+func benchmarkSource(size int) string {
+	const chunk = "Hello {{name}}, {{! note }}\n{{#items}}\n  <li>{{{title}}} {{&body}}</li>\n{{/items}}\n{{^empty}}none{{/empty}}\n"
+	return strings.Repeat(chunk, size/len(chunk)+1)
+}
+
+func benchmarkSizes(b *testing.B, oneLine bool, run func(*testing.B, string)) {
+	for _, mb := range []int{1, 2, 4, 8} {
+		source := benchmarkSource(mb << 20)
+		if oneLine {
+			source = strings.Replace(source, "\n", " ", -1)
+		}
+		b.Run(fmt.Sprintf("%dMB", mb), func(b *testing.B) {
+			b.SetBytes(int64(len(source)))
+			for i := 0; i < b.N; i++ {
+				run(b, source)
+			}
+		})
+	}
+}
+
+// BenchmarkLex and BenchmarkParse report throughput, which stays the same
+// as the template grows when lexing and parsing take linear time.
+func BenchmarkLex(b *testing.B) {
+	benchmarkSizes(b, false, func(b *testing.B, source string) {
+		l := lex(source, NewParser())
+		for l.nextItem().typ != itemEOF {
+		}
+	})
+}
+
+func BenchmarkLexLongLine(b *testing.B) {
+	benchmarkSizes(b, true, func(b *testing.B, source string) {
+		l := lex(source, NewParser())
+		for l.nextItem().typ != itemEOF {
+		}
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	benchmarkSizes(b, false, func(b *testing.B, source string) {
+		if _, err := Parse("bench.mustache", source); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+// BenchmarkParseRetained reports the memory the trees of a template keep
+// alive per byte of source, which is the same whether the source is read
+// from a string or a reader. The template is mostly text, so that copies
+// of the source stand out against the nodes made for tags.
+func BenchmarkParseRetained(b *testing.B) {
+	source := strings.Repeat(strings.Repeat("lorem ipsum ", 20)+"{{name}}\n", 1<<14)
+	parsers := map[string]func() (map[string]*parse.Tree, error){
+		"Parse": func() (map[string]*parse.Tree, error) {
+			return Parse("bench.mustache", source)
+		},
+		"ParseReader": func() (map[string]*parse.Tree, error) {
+			return ParseReader("bench.mustache", strings.NewReader(source))
+		},
+	}
+	for name, parser := range parsers {
+		b.Run(name, func(b *testing.B) {
+			var m runtime.MemStats
+			var retained int64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&m)
+				before := int64(m.HeapAlloc)
+				trees, err := parser()
+				if err != nil {
+					b.Fatal(err)
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&m)
+				retained += int64(m.HeapAlloc) - before
+				runtime.KeepAlive(trees)
+			}
+			b.ReportMetric(float64(retained)/float64(b.N)/float64(len(source)), "retained/B")
+		})
+	}
+}
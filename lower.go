@@ -0,0 +1,192 @@
+package mussed
+
+import (
+	"fmt"
+	"text/template/parse"
+
+	"github.com/acsellers/mussed/ast"
+)
+
+// Lower builds the text/template/parse trees for a parsed template: the
+// tree for the template itself and one for each of its sections and blocks.
+func Lower(t *ast.Template) map[string]*parse.Tree {
+	b := newSourceTree(t.ParseName, t.Source)
+	l := &lowering{
+		base:  b.tree,
+		bound: b,
+		tree:  newAnonymousTree(b.tree, t.Name),
+		left:  t.Left,
+		right: t.Right,
+	}
+	if l.left == "" || l.right == "" {
+		// a template built rather than parsed
+		l.left, l.right = LeftDelim, RightDelim
+	}
+	at(0, 1, l.bound, l.tree.Root)
+	l.nodes(l.tree.Root, t.Nodes)
+	return l.templates()
+}
+
+type lowering struct {
+	base       *parse.Tree
+	bound      *bound
+	tree       *parse.Tree
+	childTrees []*parse.Tree
+	anonymous  int
+	left       string
+	right      string
+}
+
+func (l *lowering) templates() map[string]*parse.Tree {
+	output := make(map[string]*parse.Tree)
+	for _, tree := range l.childTrees {
+		output[tree.Name] = tree
+	}
+	output[l.tree.Name] = l.tree
+	return output
+}
+
+// newSourceTree returns an empty tree for source, which the trees of a
+// template are copied from so ErrorContext can locate their nodes, along
+// with nodes of every kind belonging to it. Nodes only know the tree that
+// parsed them, and ErrorContext only counts lines and bytes in the text the
+// tree parsed, so the tree parses the nodes after a copy of the source with
+// everything but its line breaks blanked out. The copy holds no actions, so
+// the source is never lexed as a Go template.
+func newSourceTree(parseName, source string) *bound {
+	text := []byte(source)
+	for i, c := range text {
+		if c != '\n' {
+			text[i] = ' '
+		}
+	}
+	tree := parse.New(parseName)
+	tree.Mode = parse.ParseComments
+	tree.Parse(string(text)+`x{{/**/}}{{template "t" .}}{{if .}}{{end}}{{range $x := .x}}{{end}}{{("t").x}}`,
+		"", "", make(map[string]*parse.Tree))
+	nodes := tree.Root.Nodes
+	b := &bound{
+		tree:      tree,
+		text:      nodes[0].(*parse.TextNode),
+		comment:   nodes[1].(*parse.CommentNode),
+		template:  nodes[2].(*parse.TemplateNode),
+		ifNode:    nodes[3].(*parse.IfNode),
+		rangeNode: nodes[4].(*parse.RangeNode),
+		action:    nodes[5].(*parse.ActionNode),
+	}
+	b.text.Text = nil
+	b.pipe = b.template.Pipe
+	b.command = b.pipe.Cmds[0]
+	b.dot = b.command.Args[0].(*parse.DotNode)
+	b.variable = b.rangeNode.Pipe.Decl[0]
+	b.field = b.rangeNode.Pipe.Cmds[0].Args[0].(*parse.FieldNode)
+	b.chain = b.action.Pipe.Cmds[0].Args[0].(*parse.ChainNode)
+	b.str = b.chain.Node.(*parse.PipeNode).Cmds[0].Args[0].(*parse.StringNode)
+	tree.Root = nil
+	return b
+}
+
+// anonymousName names the next section template. Names only depend on the
+// template's name and the order its sections appear in, so parsing the
+// same template always gives the same trees and parses never share state.
+func (l *lowering) anonymousName() string {
+	name := fmt.Sprintf("%s.mussedAnonymous%d", l.tree.Name, l.anonymous)
+	l.anonymous++
+	return name
+}
+
+// at locates n at tag.
+func (l *lowering) at(tag ast.Tag, n parse.Node) parse.Node {
+	return at(int(tag.Pos), tag.Line, l.bound, n)
+}
+
+func (l *lowering) nodes(list *parse.ListNode, nodes []ast.Node) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *ast.Text:
+			list.Nodes = append(list.Nodes, at(int(n.Pos), n.Line, l.bound, newTextNode(n.Text)))
+		case *ast.Variable:
+			list.Nodes = append(list.Nodes, l.at(n.Tag, l.variable(n)))
+		case *ast.Partial:
+			list.Nodes = append(list.Nodes, l.at(n.Tag, l.partial(n)))
+		case *ast.Section:
+			tmpl, call, body := newBlockNode(l.base, l.anonymousName(), n.Name, newStringNode(n.Body), n.Left, n.Right)
+			at(int(n.Pos), n.Line, l.bound, tmpl.Root)
+			l.childTrees = append(l.childTrees, tmpl)
+			list.Nodes = append(list.Nodes, l.at(n.Tag, call))
+			l.nodes(body, n.Nodes)
+		case *ast.InvertedSection:
+			ifNode, body := newElseBlock(n.Name)
+			list.Nodes = append(list.Nodes, l.at(n.Tag, ifNode))
+			l.nodes(body, n.Nodes)
+		case *ast.Parent:
+			list.Nodes = append(list.Nodes, l.at(n.Tag, l.parent(n)))
+		case *ast.Block:
+			tmpl := l.block(n)
+			list.Nodes = append(list.Nodes, l.at(n.Tag, newBlockSlotNode(n.Name, tmpl.Name, n.Indent)))
+		case *ast.Comment:
+			// comments are kept as they are by text/template, rendering
+			// nothing
+			comment := &parse.CommentNode{NodeType: parse.NodeComment}
+			comment.Text = "/*" + n.Text + "*/"
+			list.Nodes = append(list.Nodes, l.at(n.Tag, comment))
+		}
+	}
+}
+
+func (l *lowering) variable(n *ast.Variable) parse.Node {
+	var action *parse.ActionNode
+	switch {
+	case n.Unescaped:
+		action = newUnescapedIdentNode(n.Name, l.left, l.right)
+	default:
+		action = newIdentNode(n.Name, l.left, l.right)
+	}
+	if len(n.Filters) > 0 {
+		// filters go after the lambda call and before escaping or unescaping
+		cmds := action.Pipe.Cmds
+		filtered := append([]*parse.CommandNode{}, cmds[:2]...)
+		for _, filter := range n.Filters {
+			filtered = append(filtered, newCommandIdentifierNode(filter))
+		}
+		action.Pipe.Cmds = append(filtered, cmds[2:]...)
+	}
+	return action
+}
+
+func (l *lowering) partial(n *ast.Partial) parse.Node {
+	switch {
+	case n.Dynamic:
+		return newDynamicTemplateNode(n.Name, n.Indent)
+	case n.Indent != "":
+		return newIndentedTemplateNode(n.Name, n.Indent)
+	default:
+		return newTemplateNode(n.Name)
+	}
+}
+
+// parent calls the parent template with the blocks defined directly inside
+// the parent tag, everything else in its body is discarded. A standalone
+// parent is indented like a standalone partial.
+func (l *lowering) parent(n *ast.Parent) parse.Node {
+	var overrides []string
+	for _, node := range n.Nodes {
+		if block, ok := node.(*ast.Block); ok {
+			overrides = append(overrides, block.Name, l.block(block).Name)
+		}
+	}
+	if n.Indent != "" {
+		return newIndentedParentNode(n.Name, overrides, n.Indent)
+	}
+	return newParentNode(n.Name, overrides)
+}
+
+// block builds the tree holding the content of a {{$block}}, either the
+// default content or an override.
+func (l *lowering) block(n *ast.Block) *parse.Tree {
+	tmpl, body := newBlockDefTree(l.base, l.anonymousName())
+	at(int(n.Pos), n.Line, l.bound, tmpl.Root)
+	l.childTrees = append(l.childTrees, tmpl)
+	l.nodes(body, n.Nodes)
+	return tmpl
+}
@@ -1,10 +1,17 @@
 package mussed
 
 import (
+	"fmt"
+	"io"
+	"path/filepath"
 	"strings"
 	"text/template/parse"
+
+	"github.com/acsellers/mussed/ast"
 )
 
+// The default delimiters, used by Parse and for any delimiter a Parser
+// leaves empty.
 var (
 	LeftDelim        = "{{"
 	RightDelim       = "}}"
@@ -12,44 +19,160 @@ var (
 	RightEscapeDelim = "}}}"
 )
 
+// Parser carries the settings used when parsing templates, so different
+// parts of a program can parse with different settings at the same time.
+// Empty fields fall back to the package defaults, so the zero value is
+// ready to use.
+type Parser struct {
+	LeftDelim  string
+	RightDelim string
+
+	// LeftEscapeDelim and RightEscapeDelim mark unescaped tags, like the
+	// triple mustache. They are only used while LeftDelim and RightDelim
+	// are in effect, and only when they wrap them, so after a set
+	// delimiter tag only the & sigil unescapes.
+	LeftEscapeDelim  string
+	RightEscapeDelim string
+
+	// Name maps the name a template was parsed with, usually its file
+	// name, to the name it is defined as. It defaults to removing a
+	// .mustache extension.
+	Name func(templateName string) (string, error)
+
+	// StripBOM leaves a UTF-8 byte order mark at the start of a template
+	// out of its output. Without it the mark is rendered as text.
+	StripBOM bool
+}
+
+// NewParser returns a Parser using the current package defaults.
+func NewParser() *Parser {
+	return &Parser{
+		LeftDelim:        LeftDelim,
+		RightDelim:       RightDelim,
+		LeftEscapeDelim:  LeftEscapeDelim,
+		RightEscapeDelim: RightEscapeDelim,
+		Name:             TrimExtensions(".mustache"),
+	}
+}
+
+// TrimExtensions returns a name mapping for Parser.Name that removes the
+// first of exts the name ends with. Directories are kept, with slashes as
+// separators, so they act as namespaces: "views/header.mst" becomes
+// "views/header" when trimming ".mst". Names without one of exts are kept
+// as they are.
+func TrimExtensions(exts ...string) func(string) (string, error) {
+	return func(templateName string) (string, error) {
+		name := filepath.ToSlash(templateName)
+		for _, ext := range exts {
+			if strings.HasSuffix(name, ext) {
+				name = name[:len(name)-len(ext)]
+				break
+			}
+		}
+		if name == "" || strings.HasSuffix(name, "/") {
+			return "", fmt.Errorf("mussed: template name %q has nothing but an extension", templateName)
+		}
+		return name, nil
+	}
+}
+
+// Parse parses a template with the package default settings.
 func Parse(templateName, templateContent string) (map[string]*parse.Tree, error) {
-	i := strings.Index(templateName, ".mustache")
-	name := templateName[:i] + templateName[i+len(".mustache"):]
+	return NewParser().Parse(templateName, templateContent)
+}
+
+// Parse parses templateContent into the tree for templateName and the
+// trees for each of its sections.
+func (p *Parser) Parse(templateName, templateContent string) (map[string]*parse.Tree, error) {
+	t, err := p.ParseAST(templateName, templateContent)
+	if t == nil {
+		return nil, err
+	}
+	return Lower(t), err
+}
+
+// ParseAST parses a template with the package default settings into its
+// mustache syntax tree.
+func ParseAST(templateName, templateContent string) (*ast.Template, error) {
+	return NewParser().ParseAST(templateName, templateContent)
+}
+
+// ParseAST parses templateContent into its mustache syntax tree, which
+// Lower turns into the trees Parse returns. When the template has errors
+// the tree holds what could be parsed.
+func (p *Parser) ParseAST(templateName, templateContent string) (*ast.Template, error) {
+	settings := p.withDefaults()
+	return settings.parseAST(templateName, lex(templateContent, settings))
+}
+
+// ParseReader parses a template read from r with the package default
+// settings.
+func ParseReader(templateName string, r io.Reader) (map[string]*parse.Tree, error) {
+	return NewParser().ParseReader(templateName, r)
+}
+
+// ParseReader parses the template read from r like Parse. The template is
+// read a line at a time as tags are found, so tokenizing starts before the
+// whole template has been read. An error reading r is returned as is.
+//
+// While parsing, the source read so far is held in a buffer that may be up
+// to twice its size. The trees returned keep none of it, holding the same
+// as those of Parse: their nodes, a copy of the template's text, and a
+// string as long as the source that ErrorContext locates nodes in.
+func (p *Parser) ParseReader(templateName string, r io.Reader) (map[string]*parse.Tree, error) {
+	settings := p.withDefaults()
+	l := lexLines(r, settings)
+	t, err := settings.parseAST(templateName, l)
+	if l.err != nil {
+		return nil, l.err
+	}
+	if t == nil {
+		return nil, err
+	}
+	return Lower(t), err
+}
+
+// parseAST parses the template l reads, p having its defaults filled in.
+func (p *Parser) parseAST(templateName string, l *lexer) (*ast.Template, error) {
+	name, err := p.Name(templateName)
+	if err != nil {
+		return nil, err
+	}
 
 	proto := &protoTree{
-		source:     templateContent,
-		localRight: RightDelim,
-		localLeft:  LeftDelim,
-		tree: &parse.Tree{
+		parser:     p,
+		localRight: p.RightDelim,
+		localLeft:  p.LeftDelim,
+		template: &ast.Template{
 			Name:      name,
 			ParseName: templateName,
-			Root: &parse.ListNode{
-				NodeType: parse.NodeList,
-				Nodes: []parse.Node{
-					&parse.ActionNode{
-						NodeType: parse.NodeAction,
-						Pipe: &parse.PipeNode{
-							NodeType: parse.NodePipe,
-							Decl: []*parse.VariableNode{
-								&parse.VariableNode{
-									NodeType: parse.NodeVariable,
-									Ident:    []string{"$mussedCurrent"},
-								},
-							},
-							Cmds: []*parse.CommandNode{
-								&parse.CommandNode{
-									NodeType: parse.NodeCommand,
-									Args:     []parse.Node{&parse.DotNode{}},
-								},
-							},
-						},
-					},
-				},
-			},
+			Left:      p.LeftDelim,
+			Right:     p.RightDelim,
 		},
 	}
-	proto.list = proto.tree.Root
-	proto.parse()
+	proto.localLeftEscape, proto.localRightEscape = p.escapeDelims(p.LeftDelim, p.RightDelim)
+	proto.parse(l)
+
+	return proto.template, proto.error()
+}
 
-	return proto.templates(), proto.err
+func (p *Parser) withDefaults() *Parser {
+	settings := *p
+	defaults := NewParser()
+	if settings.LeftDelim == "" {
+		settings.LeftDelim = defaults.LeftDelim
+	}
+	if settings.RightDelim == "" {
+		settings.RightDelim = defaults.RightDelim
+	}
+	if settings.LeftEscapeDelim == "" {
+		settings.LeftEscapeDelim = defaults.LeftEscapeDelim
+	}
+	if settings.RightEscapeDelim == "" {
+		settings.RightEscapeDelim = defaults.RightEscapeDelim
+	}
+	if settings.Name == nil {
+		settings.Name = defaults.Name
+	}
+	return &settings
 }
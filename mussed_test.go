@@ -0,0 +1,477 @@
+package mussed
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+func TestParserDelims(t *testing.T) {
+	// A Parser's delimiters replace the package defaults, the output of
+	// interpolation lambdas included
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		p := &Parser{LeftDelim: "<%", RightDelim: "%>"}
+		trees, err := p.Parse("test.mustache", `{{name}} <%name%> <%#list%>(<%.%>)<%/list%> <%lambda%>`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := map[string]interface{}{
+			"name":   "mussed",
+			"list":   []int{1, 2},
+			"lambda": func() string { return "{{name}}<%name%>" },
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`{{name}} mussed (1)(2) {{name}}mussed`, b.String())
+	})
+}
+
+func TestSetDelimitersEscapes(t *testing.T) {
+	// Triple mustaches only go with the Parser's delimiters, & with any
+
+	within(t, func(test *aTest) {
+		for p, sources := range map[*Parser][2]string{
+			{}: {
+				"{{=<% %>=}}{{{x}}} <%&x%> <% & x %><%={{ }}=%> {{{x}}}",
+				"{{{x}}} <b> <b> <b>",
+			},
+			{LeftDelim: "<%", RightDelim: "%>"}: {
+				"{{{x}}} <%&x%> <%x%>",
+				"{{{x}}} <b> &lt;b&gt;",
+			},
+		} {
+			t := template.New("test").Funcs(RequiredFuncs)
+			trees, err := p.Parse("test.mustache", sources[0])
+			test.IsNil(err)
+			for name, tree := range trees {
+				t, err = t.AddParseTree(name, tree)
+				test.IsNil(err)
+			}
+
+			b := new(bytes.Buffer)
+			test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{"x": "<b>"}))
+			test.AreEqual(sources[1], b.String())
+		}
+	})
+}
+
+func TestParserDefaults(t *testing.T) {
+	// The zero Parser uses the package defaults
+
+	within(t, func(test *aTest) {
+		p := NewParser()
+		test.AreEqual(LeftDelim, p.LeftDelim)
+		test.AreEqual(RightEscapeDelim, p.RightEscapeDelim)
+
+		zero := (&Parser{}).withDefaults()
+		test.AreEqual(p.LeftDelim, zero.LeftDelim)
+		test.AreEqual(p.RightDelim, zero.RightDelim)
+		test.AreEqual(p.LeftEscapeDelim, zero.LeftEscapeDelim)
+		test.AreEqual(p.RightEscapeDelim, zero.RightEscapeDelim)
+		test.IsNotNil(zero.Name)
+	})
+}
+
+func TestParseNames(t *testing.T) {
+	// Template names are mapped by the Parser's Name function
+
+	within(t, func(test *aTest) {
+		trees, err := Parse("footer", `footer`)
+		test.IsNil(err)
+		_, ok := trees["footer"]
+		test.IsTrue(ok)
+
+		trees, err = Parse("views/header.mustache", `header`)
+		test.IsNil(err)
+		_, ok = trees["views/header"]
+		test.IsTrue(ok)
+
+		p := &Parser{Name: TrimExtensions(".html.hbs", ".mst")}
+		trees, err = p.Parse("page.html.hbs", `{{#a}}{{/a}}`)
+		test.IsNil(err)
+		_, ok = trees["page"]
+		test.IsTrue(ok)
+		_, ok = trees["page.mussedAnonymous0"]
+		test.IsTrue(ok)
+
+		trees, err = p.Parse("header.mst", `header`)
+		test.IsNil(err)
+		_, ok = trees["header"]
+		test.IsTrue(ok)
+
+		_, err = Parse(".mustache", `nameless`)
+		test.IsNotNil(err)
+	})
+}
+
+func TestParseDeterministic(t *testing.T) {
+	// Section template names only depend on the template
+
+	within(t, func(test *aTest) {
+		source := `{{#a}}{{#b}}{{c}}{{/b}}{{/a}}{{^d}}{{/d}}{{#e}}{{/e}}`
+		first, err := Parse("test.mustache", source)
+		test.IsNil(err)
+		second, err := Parse("test.mustache", source)
+		test.IsNil(err)
+
+		test.AreEqual(4, len(first))
+		for name, tree := range first {
+			other, ok := second[name]
+			test.IsTrue(ok, name, "missing from second parse")
+			if ok {
+				test.IsTrue(reflect.DeepEqual(tree, other), name, "differs between parses")
+			}
+		}
+		_, ok := first["test.mussedAnonymous0"]
+		test.IsTrue(ok)
+	})
+}
+
+func TestParseConcurrent(t *testing.T) {
+	// Templates may be parsed from many goroutines at once
+
+	within(t, func(test *aTest) {
+		source := `{{#a}}{{#b}}{{c}}{{/b}}{{/a}}`
+		var wg sync.WaitGroup
+		results := make([]map[string]*parse.Tree, 8)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = Parse("test.mustache", source)
+			}(i)
+		}
+		wg.Wait()
+		for _, trees := range results {
+			test.AreEqual(3, len(trees))
+		}
+	})
+}
+
+func TestParsePositions(t *testing.T) {
+	// Generated nodes are located at the text or tag they came from
+
+	within(t, func(test *aTest) {
+		trees, err := Parse("test.mustache", "one\n{{#s}}\n  {{x}} two{{/s}}\n{{>p}}")
+		test.IsNil(err)
+
+		section := trees["test.mussedAnonymous0"]
+		test.AreEqual("test.mustache", section.ParseName)
+		nodes := section.Root.Nodes
+		test.AreEqual(4, len(nodes))
+		location, context := section.ErrorContext(nodes[2])
+		test.AreEqual("test.mustache:3:2", location)
+		test.AreEqual("{{mussedLookup $mussedCurrent \"x\" | mussedLambda $mussedCurrent \"{{\" \"}}\" | mussedEscape}}", context)
+		test.AreEqual(3, nodes[2].(*parse.ActionNode).Line)
+		location, context = section.ErrorContext(nodes[3])
+		test.AreEqual("test.mustache:3:7", location)
+		test.AreEqual(" two", context)
+
+		root := trees["test"]
+		last := root.Root.Nodes[len(root.Root.Nodes)-1].(*parse.TemplateNode)
+		test.AreEqual(4, last.Line)
+		location, _ = root.ErrorContext(last.Pipe.Cmds[0].Args[0])
+		test.AreEqual("test.mustache:4:0", location)
+	})
+}
+
+func TestParseReader(t *testing.T) {
+	// Reading a template a byte at a time parses it like Parse
+
+	within(t, func(test *aTest) {
+		long := strings.Repeat("x", 100000)
+		for _, source := range []string{
+			"",
+			"one\n{{#s}}\n  {{x}} two{{/s}}\n{{>p}}",
+			"{{=<% %>=}}\n<%#a%>{{{b}}}<%/a%>\r\n  <%! c %>  \n",
+			long + "{{" + long + "}}" + long,
+			"{{#a}}\n{{b",
+		} {
+			want, wantErr := Parse("test.mustache", source)
+			got, err := ParseReader("test.mustache", iotest.OneByteReader(strings.NewReader(source)))
+			test.AreEqual(fmt.Sprint(wantErr), fmt.Sprint(err))
+			test.AreEqual(len(want), len(got))
+			for name, tree := range want {
+				test.IsTrue(reflect.DeepEqual(tree, got[name]), name, "differs when read")
+			}
+		}
+	})
+}
+
+func TestParseReaderError(t *testing.T) {
+	// A failed read is returned rather than parsing part of the template
+
+	within(t, func(test *aTest) {
+		boom := errors.New("boom")
+		trees, err := ParseReader("test.mustache", io.MultiReader(strings.NewReader("a {{b}}\n"), iotest.ErrReader(boom)))
+		test.IsTrue(err == boom)
+		test.IsTrue(trees == nil)
+	})
+}
+
+func TestParseLineEndings(t *testing.T) {
+	// Standalone tags take their \r\n with them, other text keeps its own
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", "a\r\n  {{#s}}  \r\n{{x}}\r\n{{/s}}\r\n{{#s}}\r{{/s}}\r\nb\n")
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{"s": true, "x": 1}))
+		test.AreEqual("a\r\n1\r\n\r\r\nb\n", b.String())
+	})
+}
+
+func TestParseStripBOM(t *testing.T) {
+	// A byte order mark is only left out when the Parser asks for it
+
+	within(t, func(test *aTest) {
+		source := "\xef\xbb\xbf{{#s}}\nx{{/s}}"
+		for _, p := range []*Parser{{}, {StripBOM: true}} {
+			t := template.New("test").Funcs(RequiredFuncs)
+			trees, err := p.ParseReader("test.mustache", strings.NewReader(source))
+			test.IsNil(err)
+			for name, tree := range trees {
+				t, err = t.AddParseTree(name, tree)
+				test.IsNil(err)
+			}
+
+			b := new(bytes.Buffer)
+			test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{"s": true}))
+			if p.StripBOM {
+				test.AreEqual("x", b.String())
+			} else {
+				test.AreEqual("\xef\xbb\xbf\nx", b.String())
+			}
+		}
+	})
+}
+
+func TestParseNestedIndentedPartials(t *testing.T) {
+	// Partials indent their own lines and those of the partials they call,
+	// never the line breaks of interpolated values
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		sources := map[string]string{
+			"test.mustache":  "  {{>outer}}\n",
+			"outer.mustache": "[\n  {{>inner}}\n]\n",
+			"inner.mustache": "{{x}}\n{{{x}}}\n",
+		}
+		for file, source := range sources {
+			trees, err := Parse(file, source)
+			test.IsNil(err)
+			for name, tree := range trees {
+				t, err = t.AddParseTree(name, tree)
+				test.IsNil(err)
+			}
+		}
+
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{"x": "a\nb"}))
+		test.AreEqual("  [\n    a\nb\n    a\nb\n  ]\n", b.String())
+	})
+}
+
+func TestParseIndentedPrivateUse(t *testing.T) {
+	// The private use characters of values and templates survive the
+	// marking of line breaks in indented partials
+
+	within(t, func(test *aTest) {
+		t := Attach(template.New("test"))
+		sources := map[string]string{
+			"test.mustache":    "  {{>partial}}\n",
+			"partial.mustache": "\ue000{{x}}\ue000\n",
+		}
+		for file, source := range sources {
+			trees, err := Parse(file, source)
+			test.IsNil(err)
+			for name, tree := range trees {
+				t, err = t.AddParseTree(name, tree)
+				test.IsNil(err)
+			}
+		}
+
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", map[string]interface{}{"x": "a\ue000b\nc"}))
+		test.AreEqual("  \ue000a\ue000b\nc\ue000\n", b.String())
+	})
+}
+
+func TestSectionLambdaPartials(t *testing.T) {
+	// Section lambdas can return partials and parents, which are found in
+	// the set when it was attached
+
+	within(t, func(test *aTest) {
+		sources := map[string]string{
+			"test.mustache":   "{{#lambda}}{{/lambda}}",
+			"p.mustache":      "({{x}})",
+			"parent.mustache": "[{{$b}}default{{/b}}]",
+		}
+		data := map[string]interface{}{
+			"x":   1,
+			"dyn": "p",
+			"lambda": func(string) string {
+				return "{{>p}}|{{<parent}}{{$b}}{{x}}{{/b}}{{/parent}}|{{<parent}}{{/parent}}|{{>*dyn}}"
+			},
+		}
+
+		for _, attached := range []bool{true, false} {
+			t := template.New("test").Funcs(RequiredFuncs)
+			if attached {
+				t = Attach(t)
+			}
+			for file, source := range sources {
+				trees, err := Parse(file, source)
+				test.IsNil(err)
+				for name, tree := range trees {
+					t, err = t.AddParseTree(name, tree)
+					test.IsNil(err)
+				}
+			}
+
+			b := new(bytes.Buffer)
+			err := t.ExecuteTemplate(b, "test", data)
+			if attached {
+				test.IsNil(err)
+				test.AreEqual("(1)|[1]|[default]|(1)", b.String())
+			} else {
+				test.IsTrue(err != nil && strings.Contains(err.Error(), "no such template"), err)
+			}
+		}
+	})
+}
+
+func TestMustacheEscaping(t *testing.T) {
+	// Under text/template values are escaped exactly as mustache does,
+	// section lambda output included
+
+	within(t, func(test *aTest) {
+		t := texttemplate.New("test").
+			Funcs(texttemplate.FuncMap(RequiredFuncs)).
+			Funcs(texttemplate.FuncMap(MustacheEscaping))
+		trees, err := Parse("test.mustache", `{{x}}|{{#lambda}}{{x}}{{/lambda}}|{{{x}}}|<a href="/s?q={{x}}">`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := map[string]interface{}{
+			"x":      `'"&`,
+			"lambda": func(text string) string { return text },
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`'&quot;&amp;|'&quot;&amp;|'"&|<a href="/s?q='&quot;&amp;">`, b.String())
+	})
+}
+
+func TestParseTreesPrint(t *testing.T) {
+	// Every generated node knows its tree, so trees print and locate
+	// their nodes
+
+	within(t, func(test *aTest) {
+		trees, err := Parse("test.mustache", "{{#s}}x{{/s}}\n{{^s}}y{{/s}}\n{{>p}}")
+		test.IsNil(err)
+		for _, tree := range trees {
+			test.IsTrue(tree.Root.String() != "")
+		}
+
+		root := trees["test"]
+		var located []string
+		var walk func(parse.Node)
+		walk = func(n parse.Node) {
+			switch n := n.(type) {
+			case *parse.ListNode:
+				if n == nil {
+					return
+				}
+				for _, node := range n.Nodes {
+					walk(node)
+				}
+			case *parse.IfNode:
+				location, _ := root.ErrorContext(n)
+				located = append(located, "if "+location)
+				walk(n.List)
+				walk(n.ElseList)
+			case *parse.RangeNode:
+				location, _ := root.ErrorContext(n)
+				located = append(located, "range "+location)
+			case *parse.TemplateNode:
+				location, _ := root.ErrorContext(n)
+				located = append(located, "template "+location)
+			}
+		}
+		walk(root.Root)
+		test.AreEqual([]string{
+			"if test.mustache:1:0",
+			"if test.mustache:1:0",
+			"if test.mustache:1:0",
+			"range test.mustache:1:0",
+			"template test.mustache:1:0",
+			"if test.mustache:2:0",
+			"template test.mustache:3:0",
+		}, located)
+	})
+}
+
+func TestParseMissingPartial(t *testing.T) {
+	// Rendering a partial that is not in the set is an error, with either
+	// template package
+
+	within(t, func(test *aTest) {
+		trees, err := Parse("test.mustache", "{{>missing}}")
+		test.IsNil(err)
+
+		tt := texttemplate.New("test").Funcs(texttemplate.FuncMap(RequiredFuncs))
+		ht := template.New("test").Funcs(RequiredFuncs)
+		for name, tree := range trees {
+			tt, err = tt.AddParseTree(name, tree)
+			test.IsNil(err)
+			ht, err = ht.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		err = tt.ExecuteTemplate(new(bytes.Buffer), "test", nil)
+		test.IsTrue(err != nil && strings.Contains(err.Error(), `template "missing" not defined`), err)
+		err = ht.ExecuteTemplate(new(bytes.Buffer), "test", nil)
+		test.IsTrue(err != nil && strings.Contains(err.Error(), `no such template "missing"`), err)
+		test.IsTrue(err != nil && !strings.Contains(err.Error(), "PANIC"), err)
+	})
+}
+
+func TestParseRecursivePartial(t *testing.T) {
+	// A partial calling itself forever fails rather than crashing
+
+	within(t, func(test *aTest) {
+		trees, err := Parse("a.mustache", "{{>a}}")
+		test.IsNil(err)
+		tt := texttemplate.New("a").Funcs(texttemplate.FuncMap(RequiredFuncs))
+		for name, tree := range trees {
+			tt, err = tt.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+		err = tt.ExecuteTemplate(new(bytes.Buffer), "a", nil)
+		test.IsTrue(err != nil && strings.Contains(err.Error(), "exceeded maximum template depth"), err)
+	})
+}
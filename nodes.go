@@ -1,7 +1,7 @@
 package mussed
 
 import (
-	"fmt"
+	"strconv"
 	"strings"
 	"text/template/parse"
 )
@@ -31,9 +31,80 @@ func newTemplateNode(w string) *parse.TemplateNode {
 	}
 }
 
-func newBlockNode(a string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
-	tmplName := fmt.Sprintf("mussedAnonymous%d", mangleNum)
-	mangleNum++
+// newIndentedTemplateNode renders an indented standalone partial at render
+// time, so its lines can be indented to match the tag, when the template
+// set went through Attach. Otherwise the partial is called after the
+// indentation, which then only reaches its first line.
+func newIndentedTemplateNode(w, indent string) *parse.IfNode {
+	return &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pipe:     newActionNodeForCommands(newCommandIdentifierNode("mussedAttached")).Pipe,
+		List: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes:    []parse.Node{newPartialCallNode(w, indent)},
+		},
+		ElseList: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes:    []parse.Node{newTextNode(indent), newTemplateNode(w)},
+		},
+	}}
+}
+
+// newPartialCallNode renders the partial w with its lines indented.
+func newPartialCallNode(w, indent string) *parse.ActionNode {
+	return newActionNodeForCommands(&parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args: []parse.Node{
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedPartial",
+			},
+			&parse.VariableNode{
+				NodeType: parse.NodeVariable,
+				Ident:    []string{"$mussedCurrent"},
+			},
+			newStringNode(w),
+			newStringNode(indent),
+		},
+	})
+}
+
+// newDynamicTemplateNode renders the partial named by field, which is only
+// known at render time.
+func newDynamicTemplateNode(field, indent string) *parse.ActionNode {
+	return newActionNodeForCommands(&parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args: []parse.Node{
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedDynamicPartial",
+			},
+			&parse.VariableNode{
+				NodeType: parse.NodeVariable,
+				Ident:    []string{"$mussedCurrent"},
+			},
+			newLookupNode(field),
+			newStringNode(indent),
+		},
+	})
+}
+
+func newBlockNode(base *parse.Tree, tmplName, a string, raw *parse.StringNode, left, right string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
+	tree := newAnonymousTree(base, tmplName)
+	return tree, newBlockChooseNode(tree.Name, a, raw, left, right), tree.Root
+}
+
+// newBlockDefTree holds the content of a {{$block}}, either the default
+// content or an override.
+func newBlockDefTree(base *parse.Tree, tmplName string) (*parse.Tree, *parse.ListNode) {
+	tree := newAnonymousTree(base, tmplName)
+	return tree, tree.Root
+}
+
+// newAnonymousTree starts a tree for tmplName that shares the source and
+// ParseName of base, so its nodes are located in the template they came
+// from.
+func newAnonymousTree(base *parse.Tree, tmplName string) *parse.Tree {
 	startList := []parse.Node{
 		&parse.ActionNode{
 			NodeType: parse.NodeAction,
@@ -55,162 +126,176 @@ func newBlockNode(a string) (*parse.Tree, *parse.IfNode, *parse.ListNode) {
 		},
 	}
 
-	tree := &parse.Tree{
-		Name:      tmplName,
-		ParseName: a,
-		Root: &parse.ListNode{
-			NodeType: parse.NodeList,
-			Nodes:    startList,
-		},
+	tree := base.Copy()
+	tree.Name = tmplName
+	tree.Root = &parse.ListNode{
+		NodeType: parse.NodeList,
+		Nodes:    startList,
 	}
-	return tree, newBlockChooseNode(tmplName, a), tree.Root
+	return tree
 }
 
 func newElseBlock(f string) (*parse.IfNode, *parse.ListNode) {
 	listNode := &parse.ListNode{
 		NodeType: parse.NodeList,
 	}
-	ifNode := &parse.IfNode{
-		parse.BranchNode{
-			NodeType: parse.NodeIf,
-			Pipe: &parse.PipeNode{
-				NodeType: parse.NodePipe,
-				Cmds: []*parse.CommandNode{
-					&parse.CommandNode{
-						NodeType: parse.NodeCommand,
-						Args: []parse.Node{
-							&parse.FieldNode{
-								NodeType: parse.NodeField,
-								Ident:    strings.Split(f, "."),
-							},
+	ifNode := &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Cmds: []*parse.CommandNode{
+				newCommandLookupNode(f),
+			},
+		},
+		List: &parse.ListNode{
+			NodeType: parse.NodeList,
+		},
+		ElseList: listNode,
+	},
+	}
+	return ifNode, listNode
+}
+
+// newBlockChooseNode builds the branches for a section: lambdas are handed
+// the raw section text, collections are ranged over, and anything else that
+// is truthy renders the section once with itself pushed onto the scope.
+func newBlockChooseNode(tmpl, field string, raw *parse.StringNode, left, right string) *parse.IfNode {
+	return &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pipe:     newActionNodeForCommands(newCommandLookupNode(field)).Pipe,
+		List: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes: []parse.Node{
+				newSectionLambdaNode(tmpl, field, raw, left, right),
+			},
+		},
+	}}
+}
+
+func newSectionLambdaNode(tmpl, field string, raw *parse.StringNode, left, right string) *parse.IfNode {
+	return &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pipe: newActionNodeForCommands(
+			newCommandLookupNode(field),
+			newCommandIdentifierNode("mussedIsLambda"),
+		).Pipe,
+		List: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes: []parse.Node{
+				newActionNodeForCommands(&parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Args: []parse.Node{
+						&parse.IdentifierNode{
+							NodeType: parse.NodeIdentifier,
+							Ident:    "mussedSectionLambda",
+						},
+						&parse.VariableNode{
+							NodeType: parse.NodeVariable,
+							Ident:    []string{"$mussedCurrent"},
+						},
+						newLookupNode(field),
+						raw,
+						newStringNode(left),
+						newStringNode(right),
+						&parse.IdentifierNode{
+							NodeType: parse.NodeIdentifier,
+							Ident:    "mussedEscapeFuncs",
 						},
 					},
-				},
+				}),
 			},
-			List: &parse.ListNode{
-				NodeType: parse.NodeList,
+		},
+		ElseList: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes: []parse.Node{
+				newCollectionChooseNode(tmpl, field),
 			},
-			ElseList: listNode,
 		},
-	}
-	return ifNode, listNode
+	}}
 }
 
-func newBlockChooseNode(tmpl, field string) *parse.IfNode {
-	return &parse.IfNode{
-		parse.BranchNode{
-			NodeType: parse.NodeIf,
-			Pipe:     newIdentNode(field).Pipe,
-			List: &parse.ListNode{
-				NodeType: parse.NodeList,
-				Nodes: []parse.Node{
-					&parse.IfNode{
-						parse.BranchNode{
-							NodeType: parse.NodeIf,
-							Pipe: &parse.PipeNode{
-								NodeType: parse.NodePipe,
-								Cmds: []*parse.CommandNode{
-									&parse.CommandNode{
-										NodeType: parse.NodeCommand,
-										Args: []parse.Node{
-											&parse.FieldNode{
-												NodeType: parse.NodeField,
-												Ident:    strings.Split(field, "."),
-											},
-										},
-									},
-									&parse.CommandNode{
-										NodeType: parse.NodeCommand,
-										Args: []parse.Node{
-											&parse.IdentifierNode{
-												NodeType: parse.NodeIdentifier,
-												Ident:    "mussedIsCollection",
-											},
-										},
-									},
-								},
-							},
-							List: &parse.ListNode{
-								NodeType: parse.NodeList,
-								Nodes: []parse.Node{
-									&parse.RangeNode{
-										parse.BranchNode{
-											NodeType: parse.NodeRange,
-											Pipe: &parse.PipeNode{
-												NodeType: parse.NodePipe,
-												Cmds: []*parse.CommandNode{
-													&parse.CommandNode{
-														NodeType: parse.NodeCommand,
-														Args: []parse.Node{
-															&parse.FieldNode{
-																NodeType: parse.NodeField,
-																Ident:    []string{field},
-															},
-														},
-													},
+func newCollectionChooseNode(tmpl, field string) *parse.IfNode {
+	return &parse.IfNode{BranchNode: parse.BranchNode{
+		NodeType: parse.NodeIf,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Cmds: []*parse.CommandNode{
+				newCommandLookupNode(field),
+				&parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Args: []parse.Node{
+						&parse.IdentifierNode{
+							NodeType: parse.NodeIdentifier,
+							Ident:    "mussedIsCollection",
+						},
+					},
+				},
+			},
+		},
+		List: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes: []parse.Node{
+				&parse.RangeNode{BranchNode: parse.BranchNode{
+					NodeType: parse.NodeRange,
+					Pipe: &parse.PipeNode{
+						NodeType: parse.NodePipe,
+						Cmds: []*parse.CommandNode{
+							newCommandLookupNode(field),
+						},
+					},
+					List: &parse.ListNode{
+						NodeType: parse.NodeList,
+						Nodes: []parse.Node{
+							&parse.TemplateNode{
+								NodeType: parse.NodeTemplate,
+								Name:     tmpl,
+								Pipe: &parse.PipeNode{
+									NodeType: parse.NodePipe,
+									Cmds: []*parse.CommandNode{
+										&parse.CommandNode{
+											NodeType: parse.NodeCommand,
+											Args: []parse.Node{
+												&parse.IdentifierNode{
+													NodeType: parse.NodeIdentifier,
+													Ident:    "mussedUpscope",
 												},
-											},
-											List: &parse.ListNode{
-												NodeType: parse.NodeList,
-												Nodes: []parse.Node{
-													&parse.TemplateNode{
-														NodeType: parse.NodeTemplate,
-														Name:     tmpl,
-														Pipe: &parse.PipeNode{
-															NodeType: parse.NodePipe,
-															Cmds: []*parse.CommandNode{
-																&parse.CommandNode{
-																	NodeType: parse.NodeCommand,
-																	Args: []parse.Node{
-																		&parse.IdentifierNode{
-																			NodeType: parse.NodeIdentifier,
-																			Ident:    "mussedUpscope",
-																		},
-																		&parse.VariableNode{
-																			NodeType: parse.NodeVariable,
-																			Ident:    []string{"$mussedCurrent"},
-																		},
-																		&parse.DotNode{},
-																	},
-																},
-															},
-														},
-													},
+												&parse.VariableNode{
+													NodeType: parse.NodeVariable,
+													Ident:    []string{"$mussedCurrent"},
 												},
+												&parse.DotNode{},
 											},
 										},
 									},
 								},
 							},
-							ElseList: &parse.ListNode{
-								NodeType: parse.NodeList,
-								Nodes: []parse.Node{
-									&parse.TemplateNode{
-										NodeType: parse.NodeTemplate,
-										Name:     tmpl,
-										Pipe: &parse.PipeNode{
-											NodeType: parse.NodePipe,
-											Cmds: []*parse.CommandNode{
-												&parse.CommandNode{
-													NodeType: parse.NodeCommand,
-													Args: []parse.Node{
-														&parse.IdentifierNode{
-															NodeType: parse.NodeIdentifier,
-															Ident:    "mussedUpscope",
-														},
-														&parse.VariableNode{
-															NodeType: parse.NodeVariable,
-															Ident:    []string{"$mussedCurrent"},
-														},
-														&parse.FieldNode{
-															NodeType: parse.NodeField,
-															Ident:    strings.Split(field, "."),
-														},
-													},
-												},
-											},
-										},
+						},
+					},
+				},
+				},
+			},
+		},
+		ElseList: &parse.ListNode{
+			NodeType: parse.NodeList,
+			Nodes: []parse.Node{
+				&parse.TemplateNode{
+					NodeType: parse.NodeTemplate,
+					Name:     tmpl,
+					Pipe: &parse.PipeNode{
+						NodeType: parse.NodePipe,
+						Cmds: []*parse.CommandNode{
+							&parse.CommandNode{
+								NodeType: parse.NodeCommand,
+								Args: []parse.Node{
+									&parse.IdentifierNode{
+										NodeType: parse.NodeIdentifier,
+										Ident:    "mussedUpscope",
+									},
+									&parse.VariableNode{
+										NodeType: parse.NodeVariable,
+										Ident:    []string{"$mussedCurrent"},
 									},
+									newLookupNode(field),
 								},
 							},
 						},
@@ -218,43 +303,98 @@ func newBlockChooseNode(tmpl, field string) *parse.IfNode {
 				},
 			},
 		},
+	},
 	}
 }
 
-func newIdentNode(field string) *parse.ActionNode {
+func newIdentNode(field, left, right string) *parse.ActionNode {
 	return newActionNodeForCommands(
-		newCommandFieldNode(
-			strings.Split(field, ".")...,
-		),
+		newCommandLookupNode(field),
+		newCommandLambdaNode(left, right),
+		newCommandIdentifierNode("mussedEscape"),
 	)
 }
 
-func newYieldNode(w string) *parse.ActionNode {
+// newParentNode calls the parent template with the overriding blocks of
+// the child pushed into scope.
+func newParentNode(parent string, overrides []string) *parse.TemplateNode {
+	return &parse.TemplateNode{
+		NodeType: parse.NodeTemplate,
+		Name:     parent,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Cmds:     []*parse.CommandNode{newOverrideCommand(overrides)},
+		},
+	}
+}
+
+// newIndentedParentNode renders a standalone parent at render time, so its
+// lines can be indented to match the tag.
+func newIndentedParentNode(parent string, overrides []string, indent string) *parse.ActionNode {
+	return newActionNodeForCommands(&parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args: []parse.Node{
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedPartial",
+			},
+			&parse.PipeNode{
+				NodeType: parse.NodePipe,
+				Cmds:     []*parse.CommandNode{newOverrideCommand(overrides)},
+			},
+			newStringNode(parent),
+			newStringNode(indent),
+		},
+	})
+}
+
+// newOverrideCommand gives the scope a parent renders in, with overrides
+// pairing block names with the templates overriding them.
+func newOverrideCommand(overrides []string) *parse.CommandNode {
 	args := []parse.Node{
 		&parse.IdentifierNode{
 			NodeType: parse.NodeIdentifier,
-			Ident:    "yield",
+			Ident:    "mussedOverride",
+		},
+		&parse.VariableNode{
+			NodeType: parse.NodeVariable,
+			Ident:    []string{"$mussedCurrent"},
 		},
 	}
-	tw := strings.TrimSpace(w)
-	if tw != "" {
-		args = append(args, &parse.StringNode{
-			NodeType: parse.NodeString,
-			Quoted:   tw,
-			Text:     tw,
-		})
+	for _, o := range overrides {
+		args = append(args, newStringNode(o))
 	}
-	args = append(args, &parse.DotNode{})
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args:     args,
+	}
+}
 
+// newBlockSlotNode renders either the override for a block or its default
+// content.
+func newBlockSlotNode(name, tmpl, indent string) *parse.ActionNode {
 	return newActionNodeForCommands(&parse.CommandNode{
 		NodeType: parse.NodeCommand,
-		Args:     args,
+		Args: []parse.Node{
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedBlock",
+			},
+			&parse.VariableNode{
+				NodeType: parse.NodeVariable,
+				Ident:    []string{"$mussedCurrent"},
+			},
+			newStringNode(name),
+			newStringNode(tmpl),
+			newStringNode(indent),
+		},
 	})
 }
 
-func newUnescapedIdentNode(field string) *parse.ActionNode {
+func newUnescapedIdentNode(field, left, right string) *parse.ActionNode {
 	return newActionNodeForCommands(
-		newCommandFieldNode(strings.Split(field, ".")...),
+		newCommandLookupNode(field),
+		newCommandLambdaNode(left, right),
 		newCommandIdentifierNode("mussedUnescape"),
 	)
 }
@@ -269,17 +409,49 @@ func newActionNodeForCommands(cn ...*parse.CommandNode) *parse.ActionNode {
 	}
 }
 
-func newCommandFieldNode(fields ...string) *parse.CommandNode {
+// newLookupNode looks field up in the scope, calling it when it is a
+// method of a struct in scope, and then looks up any names after its
+// first dot within what it found: (mussedLookup $mussedCurrent "a").b.c
+func newLookupNode(field string) parse.Node {
+	names := strings.Split(field, ".")
+	resolve := &parse.PipeNode{
+		NodeType: parse.NodePipe,
+		Cmds:     []*parse.CommandNode{newCommandLookupNode(names[0])},
+	}
+	if len(names) == 1 {
+		return resolve
+	}
+	return &parse.ChainNode{
+		NodeType: parse.NodeChain,
+		Node:     resolve,
+		Field:    names[1:],
+	}
+}
+
+// newCommandLookupNode is a command looking field up like newLookupNode.
+func newCommandLookupNode(field string) *parse.CommandNode {
+	if field != "." && strings.Contains(field, ".") {
+		return &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Args:     []parse.Node{newLookupNode(field)},
+		}
+	}
 	return &parse.CommandNode{
 		NodeType: parse.NodeCommand,
 		Args: []parse.Node{
-			&parse.FieldNode{
-				NodeType: parse.NodeField,
-				Ident:    fields,
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedLookup",
+			},
+			&parse.VariableNode{
+				NodeType: parse.NodeVariable,
+				Ident:    []string{"$mussedCurrent"},
 			},
+			newStringNode(field),
 		},
 	}
 }
+
 func newCommandIdentifierNode(ident string) *parse.CommandNode {
 	return &parse.CommandNode{
 		NodeType: parse.NodeCommand,
@@ -291,3 +463,150 @@ func newCommandIdentifierNode(ident string) *parse.CommandNode {
 		},
 	}
 }
+
+// newCommandLambdaNode renders interpolation lambdas against the
+// template's default delimiters, passing any other value through
+// untouched.
+func newCommandLambdaNode(left, right string) *parse.CommandNode {
+	return &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Args: []parse.Node{
+			&parse.IdentifierNode{
+				NodeType: parse.NodeIdentifier,
+				Ident:    "mussedLambda",
+			},
+			&parse.VariableNode{
+				NodeType: parse.NodeVariable,
+				Ident:    []string{"$mussedCurrent"},
+			},
+			newStringNode(left),
+			newStringNode(right),
+		},
+	}
+}
+
+// bound holds nodes parsed by the tree holding a template's source. The
+// nodes generated for the template are rebuilt from them, as nodes can only
+// be printed, and so located by ErrorContext, once they know the tree they
+// are in. Lists are left as they are, as they print without their tree and
+// sections fill theirs in after the section's tag is located.
+type bound struct {
+	tree      *parse.Tree
+	action    *parse.ActionNode
+	chain     *parse.ChainNode
+	command   *parse.CommandNode
+	comment   *parse.CommentNode
+	dot       *parse.DotNode
+	field     *parse.FieldNode
+	ifNode    *parse.IfNode
+	pipe      *parse.PipeNode
+	rangeNode *parse.RangeNode
+	str       *parse.StringNode
+	template  *parse.TemplateNode
+	text      *parse.TextNode
+	variable  *parse.VariableNode
+}
+
+// at records pos and line, where in the source the tag n was generated for
+// is, on n and the nodes within it, so ErrorContext and failures executing
+// them point at the tag, and rebuilds them from b to belong to its tree.
+func at(pos, line int, b *bound, n parse.Node) parse.Node {
+	p := parse.Pos(pos)
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			break
+		}
+		n.Pos = p
+		for i, node := range n.Nodes {
+			n.Nodes[i] = at(pos, line, b, node)
+		}
+	case *parse.ActionNode:
+		m := b.action.Copy().(*parse.ActionNode)
+		m.Pos, m.Line = p, line
+		m.Pipe = at(pos, line, b, n.Pipe).(*parse.PipeNode)
+		return m
+	case *parse.IfNode:
+		m := b.ifNode.Copy().(*parse.IfNode)
+		m.Pos, m.Line = p, line
+		m.Pipe = at(pos, line, b, n.Pipe).(*parse.PipeNode)
+		m.List = at(pos, line, b, n.List).(*parse.ListNode)
+		m.ElseList = at(pos, line, b, n.ElseList).(*parse.ListNode)
+		return m
+	case *parse.RangeNode:
+		m := b.rangeNode.Copy().(*parse.RangeNode)
+		m.Pos, m.Line = p, line
+		m.Pipe = at(pos, line, b, n.Pipe).(*parse.PipeNode)
+		m.List = at(pos, line, b, n.List).(*parse.ListNode)
+		m.ElseList = at(pos, line, b, n.ElseList).(*parse.ListNode)
+		return m
+	case *parse.TemplateNode:
+		m := b.template.Copy().(*parse.TemplateNode)
+		m.Pos, m.Line, m.Name = p, line, n.Name
+		m.Pipe = at(pos, line, b, n.Pipe).(*parse.PipeNode)
+		return m
+	case *parse.PipeNode:
+		if n == nil {
+			break
+		}
+		m := b.pipe.CopyPipe()
+		m.Pos, m.Line, m.IsAssign = p, line, n.IsAssign
+		m.Decl = make([]*parse.VariableNode, len(n.Decl))
+		for i, v := range n.Decl {
+			m.Decl[i] = at(pos, line, b, v).(*parse.VariableNode)
+		}
+		m.Cmds = make([]*parse.CommandNode, len(n.Cmds))
+		for i, c := range n.Cmds {
+			m.Cmds[i] = at(pos, line, b, c).(*parse.CommandNode)
+		}
+		return m
+	case *parse.CommandNode:
+		m := b.command.Copy().(*parse.CommandNode)
+		m.Pos = p
+		m.Args = make([]parse.Node, len(n.Args))
+		for i, arg := range n.Args {
+			m.Args[i] = at(pos, line, b, arg)
+		}
+		return m
+	case *parse.ChainNode:
+		m := b.chain.Copy().(*parse.ChainNode)
+		m.Pos, m.Field = p, n.Field
+		m.Node = at(pos, line, b, n.Node)
+		return m
+	case *parse.FieldNode:
+		m := b.field.Copy().(*parse.FieldNode)
+		m.Pos, m.Ident = p, n.Ident
+		return m
+	case *parse.VariableNode:
+		m := b.variable.Copy().(*parse.VariableNode)
+		m.Pos, m.Ident = p, n.Ident
+		return m
+	case *parse.IdentifierNode:
+		return parse.NewIdentifier(n.Ident).SetTree(b.tree).SetPos(p)
+	case *parse.DotNode:
+		m := b.dot.Copy().(*parse.DotNode)
+		m.Pos = p
+		return m
+	case *parse.StringNode:
+		m := b.str.Copy().(*parse.StringNode)
+		m.Pos, m.Quoted, m.Text = p, n.Quoted, n.Text
+		return m
+	case *parse.TextNode:
+		m := b.text.Copy().(*parse.TextNode)
+		m.Pos, m.Text = p, n.Text
+		return m
+	case *parse.CommentNode:
+		m := b.comment.Copy().(*parse.CommentNode)
+		m.Pos, m.Text = p, n.Text
+		return m
+	}
+	return n
+}
+
+func newStringNode(s string) *parse.StringNode {
+	return &parse.StringNode{
+		NodeType: parse.NodeString,
+		Quoted:   strconv.Quote(s),
+		Text:     s,
+	}
+}
@@ -1,11 +1,11 @@
 package mussed
 
 import (
-	"bufio"
 	"bytes"
-	"fmt"
-	"io"
 	"strings"
+	"unicode"
+
+	"github.com/acsellers/mussed/ast"
 )
 
 const (
@@ -15,11 +15,15 @@ const (
 	ident
 	unescaped
 	templateCall
-	yield
-	noop
+	parentCall
+	blockDef
+	setDelimiters
+	comment
 	erroring
 )
 
+// scanLines splits the source after each \n, so unlike bufio.ScanLines it
+// keeps line endings, \r\n included, with the line they end.
 func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
 		return 0, nil, nil
@@ -36,48 +40,75 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return 0, nil, nil
 }
 
-func (pt *protoTree) parse() {
-	currentWork := &stash{tree: pt}
-	scanner := bufio.NewScanner(pt.Reader())
-	scanner.Split(scanLines)
-
-	for scanner.Scan() {
-		currentWork.Append(scanner.Text())
-		if currentWork.hasAction() {
-			if currentWork.needsMoreText() {
-				continue
+// parse builds the template from the items l finds, keeping pt.source up
+// to date with what l has read of the source.
+func (pt *protoTree) parse(l *lexer) {
+	pt.lexer = l
+	for {
+		it := l.nextItem()
+		pt.source = l.input
+		switch it.typ {
+		case itemText:
+			pt.settleDedent(it)
+			text := it.val
+			if dedent := pt.dedent(); dedent != "" {
+				start := it.pos == 0 || pt.source[it.pos-1] == '\n'
+				text = dedentLines(text, dedent, start)
 			}
-		} else {
+			pt.add(&ast.Text{Pos: ast.Pos(it.pos), Line: it.line, Text: text})
 			continue
-		}
-		for currentWork.hasAction() && !currentWork.needsMoreText() {
-			precedingText, action := currentWork.pullToAction()
-			pt.list.Nodes = append(pt.list.Nodes, newTextNode(precedingText))
-
-			switch pt.actionPurpose(action) {
-			case ident:
-				pt.insertIdentNode(action)
-			case templateCall:
-				pt.insertTemplateNode(action)
-			case yield:
-				pt.insertYieldNode(action)
-			case openBlock:
-				pt.startBlock(action)
-			case closeBlock:
-				pt.endBlock(action)
-			case elseBlock:
-				pt.startElseBlock(action)
+		case itemError:
+			if pt.sigil(it.val) == '!' {
+				pt.errorf(it.pos, it.val, "comment is never closed, expected %q", pt.localRight)
+			} else if pt.escaped(it.val) {
+				pt.errorf(it.pos, it.val, "unterminated tag, expected %q", pt.localRightEscape)
+			} else {
+				pt.errorf(it.pos, it.val, "unterminated tag, expected %q", pt.localRight)
 			}
 		}
-	}
+		if it.typ != itemTag {
+			break
+		}
 
-	if currentWork.hasAction() && currentWork.needsMoreText() {
-		pt.err = fmt.Errorf("unterminated delimeter")
-	} else {
-		if len(currentWork.content) > 0 {
-			pt.list.Nodes = append(pt.list.Nodes, newTextNode(currentWork.content))
+		pt.settleDedent(it)
+		indent := trimIndent(it.indent, pt.dedent())
+		tag := ast.Tag{Pos: ast.Pos(it.pos), Line: it.line, Raw: it.val}
+		switch pt.actionPurpose(it.val, it.pos) {
+		case ident:
+			pt.insertIdentNode(tag)
+		case templateCall:
+			pt.insertTemplateNode(tag, indent)
+		case parentCall:
+			pt.startParent(tag, indent)
+		case blockDef:
+			pt.startBlockDef(tag, it, indent)
+		case openBlock:
+			pt.startBlock(tag, it.to)
+		case closeBlock:
+			pt.endBlock(tag, it.from)
+		case elseBlock:
+			pt.startElseBlock(tag)
+		case setDelimiters:
+			pt.add(&ast.SetDelimiters{Tag: tag, Left: pt.localLeft, Right: pt.localRight})
+		case comment:
+			pt.add(&ast.Comment{Tag: tag, Text: pt.extract(it.val)})
 		}
 	}
+
+	for _, section := range pt.sections {
+		pt.errorf(int(section.tag.Pos), section.tag.Raw, "section %q is never closed", section.name)
+	}
+	pt.template.Source = pt.source
+}
+
+// sigil returns the first character inside the tag a, or 0 when there is
+// nothing there.
+func (pt *protoTree) sigil(a string) byte {
+	inner := strings.TrimSpace(strings.TrimPrefix(a, pt.localLeft))
+	if inner == "" {
+		return 0
+	}
+	return inner[0]
 }
 
 func (pt *protoTree) hasDelims(s string) bool {
@@ -85,128 +116,318 @@ func (pt *protoTree) hasDelims(s string) bool {
 		strings.Index(s, pt.localLeft) >= 0
 }
 
-func (pt *protoTree) actionPurpose(w string) int {
-	if strings.Contains(w, LeftEscapeDelim) {
-		return ident
+// escaped reports whether the tag w uses the escape delimiters.
+func (pt *protoTree) escaped(w string) bool {
+	return pt.localLeftEscape != "" && strings.HasPrefix(w, pt.localLeftEscape)
+}
+
+func (pt *protoTree) actionPurpose(w string, pos int) int {
+	if pt.escaped(w) {
+		return pt.named(w, pos, ident)
+	}
+	tw := strings.TrimSpace(w[len(pt.localLeft) : len(w)-len(pt.localRight)])
+	if tw == "" {
+		pt.errorf(pos, w, "empty tag")
+		return erroring
 	}
-	w = w[len(pt.localLeft) : len(w)-len(pt.localRight)]
-	tw := strings.TrimSpace(w)
 	switch tw[0] {
 	// start a range/call/if block
 	case '#':
-		return openBlock
+		return pt.named(w, pos, openBlock)
 
 		// end a block
 	case '/':
-		return closeBlock
+		return pt.named(w, pos, closeBlock)
 
 		// start an else block
 	case '^':
-		return elseBlock
+		return pt.named(w, pos, elseBlock)
 
-		// template/yield
+		// template call
 	case '>':
-		return templateCall
+		return pt.named(w, pos, templateCall)
 
-		// yield block
+		// extend a parent template
 	case '<':
-		return yield
+		return pt.named(w, pos, parentCall)
+
+		// overridable block
+	case '$':
+		return pt.named(w, pos, blockDef)
 
 		// switch delimeters
 	case '=':
-		delims := strings.SplitN(strings.TrimSpace(tw[1:len(tw)-1]), " ", 2)
-		if len(delims) != 2 {
-			if len(delims)%2 == 0 {
-				delims = []string{delims[0][0 : len(delims[0])/2], delims[0][len(delims[0])/2 : len(delims[0])]}
-			} else {
-				return noop
-			}
+		if len(tw) < 2 || tw[len(tw)-1] != '=' {
+			pt.errorf(pos, w, "set delimiter tag must end with '='")
+			return erroring
+		}
+		left, right, ok := parseDelimiters(tw)
+		if !ok {
+			pt.errorf(pos, w, "set delimiter tag needs two delimiters without whitespace or '='")
+			return erroring
 		}
-		pt.localLeft = strings.TrimSpace(delims[0])
-		pt.localRight = strings.TrimSpace(delims[1])
+		pt.localLeft = left
+		pt.localRight = right
+		pt.localLeftEscape, pt.localRightEscape = pt.parser.escapeDelims(left, right)
 
-		return noop
+		return setDelimiters
 
 		// comment block
 	case '!':
-		return noop
+		return comment
 
 		// .ident block
 	case '&':
-		return ident
+		return pt.named(w, pos, ident)
 
 	default:
-		return ident
+		return pt.named(w, pos, ident)
 	}
 }
 
-func (pt *protoTree) Reader() io.Reader {
-	return bytes.NewBufferString(pt.source)
+// named checks that the tag w names something, returning purpose when it
+// does and recording an error when it does not.
+func (pt *protoTree) named(w string, pos, purpose int) int {
+	name := pt.extract(w)
+	if purpose == templateCall && strings.HasPrefix(name, "*") {
+		name = strings.TrimSpace(name[1:])
+	}
+	switch {
+	case name == "":
+		pt.errorf(pos, w, "tag is missing a name")
+		return erroring
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		pt.errorf(pos, w, "tag name %q contains whitespace", name)
+		return erroring
+	}
+	return purpose
 }
 
 func (pt *protoTree) extract(s string) string {
-	if strings.HasPrefix(s, LeftEscapeDelim) &&
-		strings.HasSuffix(s, RightEscapeDelim) {
-		s = s[len(LeftEscapeDelim):]
-		s = s[:len(s)-len(RightEscapeDelim)]
-	}
-	if strings.HasPrefix(s, pt.localLeft) &&
+	if pt.escaped(s) && strings.HasSuffix(s, pt.localRightEscape) {
+		s = s[len(pt.localLeftEscape):]
+		s = s[:len(s)-len(pt.localRightEscape)]
+	} else if strings.HasPrefix(s, pt.localLeft) &&
 		strings.HasSuffix(s, pt.localRight) {
 		s = s[len(pt.localLeft):]
 		s = s[:len(s)-len(pt.localRight)]
 	}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return s
+	}
 	switch s[0] {
-	case '#', '/', '^', '>', '<', '=', '!', '&':
+	case '#', '/', '^', '>', '<', '$', '=', '!', '&':
 		s = s[1:]
 	}
 
 	return strings.TrimSpace(s)
 }
 
-func (pt *protoTree) insertIdentNode(a string) {
-	if pt.unescapedAction(a) {
-		un := newUnescapedIdentNode(pt.extract(a))
-		pt.list.Nodes = append(pt.list.Nodes, un)
-	} else {
-		ax := pt.extract(a)
-		if ax == "." {
-			ax = "mussedItem"
+func (pt *protoTree) insertIdentNode(tag ast.Tag) {
+	pt.add(&ast.Variable{Tag: tag, Name: pt.extract(tag.Raw), Unescaped: pt.unescapedAction(tag.Raw)})
+}
+
+// insertTemplateNode adds a partial, which indents its output by indent
+// when its tag is standalone.
+func (pt *protoTree) insertTemplateNode(tag ast.Tag, indent string) {
+	partial := &ast.Partial{Tag: tag, Name: pt.extract(tag.Raw), Indent: indent}
+	if strings.HasPrefix(partial.Name, "*") {
+		partial.Name = strings.TrimSpace(partial.Name[1:])
+		partial.Dynamic = true
+	}
+	pt.add(partial)
+}
+
+// startBlock opens a section, whose body starts at offset body.
+func (pt *protoTree) startBlock(tag ast.Tag, body int) {
+	section := &ast.Section{Tag: tag, Name: pt.extract(tag.Raw), Left: pt.localLeft, Right: pt.localRight}
+	pt.open(section, &openSection{
+		kind:  openBlock,
+		name:  section.Name,
+		tag:   tag,
+		nodes: &section.Nodes,
+		end:   &section.End,
+		body:  &section.Body,
+		from:  body,
+	})
+}
+
+// endBlock closes the innermost section, the body of which ends at offset
+// body.
+func (pt *protoTree) endBlock(tag ast.Tag, body int) {
+	name := pt.extract(tag.Raw)
+	pos := int(tag.Pos)
+	if len(pt.sections) == 0 {
+		pt.errorf(pos, tag.Raw, "closing tag for %q without an open section", name)
+		return
+	}
+	section := pt.sections[len(pt.sections)-1]
+	if section.name != name {
+		pt.errorf(pos, tag.Raw, "closing tag for %q does not match section %q opened on line %d",
+			name, section.name, section.tag.Line)
+		// recover by closing everything up to a matching section, when
+		// one is open, otherwise the tag is ignored
+		if !pt.sectionOpen(name) {
+			return
+		}
+		for section.name != name {
+			pt.sections = pt.sections[:len(pt.sections)-1]
+			section = pt.sections[len(pt.sections)-1]
+		}
+	}
+	pt.sections = pt.sections[:len(pt.sections)-1]
+
+	*section.end = tag
+	if section.body != nil {
+		*section.body = pt.lexer.keep(pt.source[section.from:body])
+	}
+}
+
+func (pt *protoTree) startElseBlock(tag ast.Tag) {
+	inverted := &ast.InvertedSection{Tag: tag, Name: pt.extract(tag.Raw)}
+	pt.open(inverted, &openSection{
+		kind:  elseBlock,
+		name:  inverted.Name,
+		tag:   tag,
+		nodes: &inverted.Nodes,
+		end:   &inverted.End,
+	})
+}
+
+// startParent begins a {{<parent}} tag, which indents the parent by indent
+// when its tag is standalone.
+func (pt *protoTree) startParent(tag ast.Tag, indent string) {
+	parent := &ast.Parent{Tag: tag, Name: pt.extract(tag.Raw), Indent: indent}
+	pt.open(parent, &openSection{
+		kind:  parentCall,
+		name:  parent.Name,
+		tag:   tag,
+		nodes: &parent.Nodes,
+		end:   &parent.End,
+	})
+}
+
+// startBlockDef begins a {{$block}} tag, which is an override when directly
+// inside a parent tag and a replaceable region with default content
+// everywhere else. A region only preceded by whitespace on its line is
+// indented by it, like a standalone partial. When the tag ends its line the
+// content loses the indentation of its first line, see settleDedent.
+func (pt *protoTree) startBlockDef(tag ast.Tag, it item, indent string) {
+	block := &ast.Block{Tag: tag, Name: pt.extract(tag.Raw)}
+	if len(pt.sections) == 0 || pt.sections[len(pt.sections)-1].kind != parentCall {
+		if it.from == it.pos {
+			indent = trimIndent(pt.takeIndent(it.pos), pt.dedent())
 		}
-		an := newIdentNode(ax)
-		pt.list.Nodes = append(pt.list.Nodes, an)
+		block.Indent = indent
+	}
+	section := &openSection{
+		kind:       blockDef,
+		name:       block.Name,
+		tag:        tag,
+		nodes:      &block.Nodes,
+		end:        &block.End,
+		dedentFrom: -1,
+	}
+	if it.to > it.pos+len(it.val) {
+		section.dedentFrom = it.to
 	}
+	pt.open(block, section)
 }
 
-func (pt *protoTree) insertTemplateNode(a string) {
-	tn := newTemplateNode(pt.extract(a))
-	pt.list.Nodes = append(pt.list.Nodes, tn)
+// takeIndent removes the whitespace before pos on its line from the text
+// added last, returning it, when there is nothing else before pos on the
+// line.
+func (pt *protoTree) takeIndent(pos int) string {
+	from := pos
+	for from > 0 && isSpace(pt.source[from-1]) {
+		from--
+	}
+	if from == pos || from > 0 && pt.source[from-1] != '\n' {
+		return ""
+	}
+	nodes := &pt.template.Nodes
+	if len(pt.sections) > 0 {
+		nodes = pt.sections[len(pt.sections)-1].nodes
+	}
+	last := len(*nodes) - 1
+	if last < 0 {
+		return ""
+	}
+	text, ok := (*nodes)[last].(*ast.Text)
+	if !ok || int(text.Pos)+len(text.Text) != pos {
+		return ""
+	}
+	indent := pt.source[from:pos]
+	text.Text = strings.TrimSuffix(text.Text, indent)
+	if text.Text == "" {
+		*nodes = (*nodes)[:last]
+	}
+	return indent
 }
 
-func (pt *protoTree) insertYieldNode(a string) {
-	yn := newYieldNode(pt.extract(a))
-	pt.list.Nodes = append(pt.list.Nodes, yn)
+// settleDedent works out the indentation a block whose opening tag ends its
+// line removes from its content, which is that of the content's first line,
+// once it takes it, the first item after the tag.
+func (pt *protoTree) settleDedent(it item) {
+	if len(pt.sections) == 0 {
+		return
+	}
+	section := pt.sections[len(pt.sections)-1]
+	if section.kind != blockDef || section.dedentFrom < 0 || section.dedentSettled {
+		return
+	}
+	section.dedentSettled = true
+	switch {
+	case it.from != section.dedentFrom:
+	case it.typ == itemText:
+		section.dedent = it.val[:len(it.val)-len(strings.TrimLeft(it.val, " \t"))]
+	default:
+		section.dedent = it.indent
+	}
 }
 
-func (pt *protoTree) startBlock(a string) {
-	tmpl, call, list := newBlockNode(pt.extract(a))
-	pt.childTrees = append(pt.childTrees, tmpl)
-	pt.list.Nodes = append(pt.list.Nodes, call)
-	pt.push(pt.list)
-	pt.list = list
+// dedent returns the indentation removed from the lines of the innermost
+// block that removes any.
+func (pt *protoTree) dedent() string {
+	for i := len(pt.sections) - 1; i >= 0; i-- {
+		if section := pt.sections[i]; section.kind == blockDef && section.dedentFrom >= 0 {
+			return section.dedent
+		}
+	}
+	return ""
 }
 
-func (pt *protoTree) endBlock(a string) {
-	pt.list = pt.pop()
+// dedentLines removes indent, or as much of it as a line starts with, from
+// each line of s. start tells whether s starts a line.
+func dedentLines(s, indent string, start bool) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if i > 0 || start {
+			lines[i] = line[len(line)-len(trimIndent(line, indent)):]
+		}
+	}
+	return strings.Join(lines, "")
 }
 
-func (pt *protoTree) startElseBlock(a string) {
-	ifNode, list := newElseBlock(pt.extract(a))
-	pt.list.Nodes = append(pt.list.Nodes, ifNode)
-	pt.push(pt.list)
-	pt.list = list
+// trimIndent removes indent, or as much of it as s starts with, from s.
+func trimIndent(s, indent string) string {
+	n := 0
+	for n < len(s) && n < len(indent) && s[n] == indent[n] {
+		n++
+	}
+	return s[n:]
+}
+
+func (pt *protoTree) sectionOpen(name string) bool {
+	for _, section := range pt.sections {
+		if section.name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (pt *protoTree) unescapedAction(s string) bool {
-	return strings.HasPrefix(s, LeftEscapeDelim) ||
-		strings.HasPrefix(s, pt.localLeft+"&")
+	return pt.escaped(s) || pt.sigil(s) == '&'
 }
@@ -169,9 +169,7 @@ func TestPARTIALS6(t *testing.T) {
 
 	within(t, func(test *aTest) {
 		t := template.New("test").Funcs(RequiredFuncs)
-		trees, err := Parse("test.mustache", `|
-{{>partial}}
-|`)
+		trees, err := Parse("test.mustache", "|\r\n{{>partial}}\r\n|")
 		test.IsNil(err)
 		for name, tree := range trees {
 			t, err = t.AddParseTree(name, tree)
@@ -189,8 +187,7 @@ func TestPARTIALS6(t *testing.T) {
 		test.IsNil(json.Unmarshal([]byte(`{}`), &data))
 		b := new(bytes.Buffer)
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
-		test.AreEqual(`|
->|`, b.String())
+		test.AreEqual("|\r\n>|", b.String())
 	})
 }
 
@@ -259,7 +256,7 @@ func TestPARTIALS9(t *testing.T) {
 	// Standalone Indentation
 
 	within(t, func(test *aTest) {
-		t := template.New("test").Funcs(RequiredFuncs)
+		t := Attach(template.New("test"))
 		trees, err := Parse("test.mustache", `\
  {{>partial}}
 /
@@ -286,9 +283,9 @@ func TestPARTIALS9(t *testing.T) {
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
 		test.AreEqual(`\
  |
-<
+ <
 ->
-|
+ |
 /
 `, b.String())
 	})
@@ -1,44 +1,53 @@
 package mussed
 
-import (
-	"text/template/parse"
-)
-
-var mangleNum int
+import "github.com/acsellers/mussed/ast"
 
 type protoTree struct {
 	source     string
-	tree       *parse.Tree
-	childTrees []*parse.Tree
-	list       *parse.ListNode
-	stack      []*parse.ListNode
-	err        error
+	lexer      *lexer
+	parser     *Parser
+	template   *ast.Template
+	sections   []*openSection
+	problems   []problem
 	localLeft  string
 	localRight string
+
+	// the escape delimiters in effect, empty when there are none
+	localLeftEscape  string
+	localRightEscape string
 }
 
-func (pt *protoTree) templates() map[string]*parse.Tree {
-	output := make(map[string]*parse.Tree)
-	for _, tree := range pt.childTrees {
-		output[tree.Name] = tree
+// add appends n to the innermost open section, or the template when no
+// section is open.
+func (pt *protoTree) add(n ast.Node) {
+	if len(pt.sections) == 0 {
+		pt.template.Nodes = append(pt.template.Nodes, n)
+		return
 	}
-	output[pt.tree.Name] = pt.tree
-
-	return output
+	section := pt.sections[len(pt.sections)-1]
+	*section.nodes = append(*section.nodes, n)
 }
 
-func (pt *protoTree) pop() *parse.ListNode {
-	if len(pt.stack) == 0 {
-		return pt.tree.Root
-	}
-	ln := pt.stack[len(pt.stack)-1]
-	if len(pt.stack) == 1 {
-		pt.stack = pt.stack[1:]
-	} else {
-		pt.stack = pt.stack[:len(pt.stack)-2]
-	}
-	return ln
+// open adds n, a tag with nodes of its own, and makes it the innermost
+// open section.
+func (pt *protoTree) open(n ast.Node, section *openSection) {
+	pt.add(n)
+	pt.sections = append(pt.sections, section)
 }
-func (pt *protoTree) push(ln *parse.ListNode) {
-	pt.stack = append(pt.stack, ln)
+
+type openSection struct {
+	kind  int
+	name  string
+	tag   ast.Tag
+	nodes *[]ast.Node
+	end   *ast.Tag
+	body  *string
+	from  int // where the body starts in the source
+
+	// a block whose opening tag ends its line removes dedent, the
+	// indentation of the line starting at dedentFrom, from its lines,
+	// which is known once dedentSettled
+	dedentFrom    int
+	dedent        string
+	dedentSettled bool
 }
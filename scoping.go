@@ -1,41 +1,82 @@
 package mussed
 
 import (
+	"fmt"
 	"reflect"
 )
 
-func upscope(d interface{}, i interface{}) map[string]interface{} {
-	dot, ok := d.(map[string]interface{})
-	if !ok {
-		dot = make(map[string]interface{})
-	} else {
-		if dot == nil {
-			dot = make(map[string]interface{})
-		}
+// scope is the context stack of a render. Each section pushes the item it
+// renders onto the scope it was rendered in, linking back to it rather
+// than copying what it holds, so entering a section costs the same however
+// much data is in scope. Scopes are never modified once made; popping one
+// is simply returning to the parent, which the template that rendered the
+// section still holds. This keeps rendering free of side effects and safe
+// when many goroutines execute the same template over the same data.
+type scope struct {
+	parent *scope
+	item   interface{}
+	// blocks maps the blocks overridden by child templates to the
+	// templates rendering them, see override
+	blocks map[string]blockOverride
+	// lineMark stands in for line breaks in indented renders, see indented
+	lineMark string
+}
+
+// scopeOf returns ctx as a scope. A root context is the only item of a
+// scope of its own.
+func scopeOf(ctx interface{}) *scope {
+	if s, ok := ctx.(*scope); ok {
+		return s
 	}
-	var changes *mussedRecord
-	subject := i
+	return &scope{item: ctx}
+}
 
-	switch {
-	case mapType(subject):
-		changes = upscopeMap(dot, subject)
-	case structType(subject):
-		changes = upscopeStruct(dot, subject)
-	default:
-		dot["mussedItem"] = i
-		return dot
-	}
-	if list, ok := dot["mussedScopeList"]; ok {
-		if records, ok := list.([]*mussedRecord); ok {
-			dot["mussedScopeList"] = append(records, changes)
-		} else {
-			dot["mussedScopeList"] = []*mussedRecord{changes}
+// withState returns a copy of the scope ctx, holding the same items, that
+// the render state can be changed on.
+func withState(ctx interface{}) *scope {
+	s := *scopeOf(ctx)
+	return &s
+}
+
+// upscope pushes i onto the scope d.
+func upscope(d interface{}, i interface{}) *scope {
+	parent := scopeOf(d)
+	return &scope{
+		parent:   parent,
+		item:     i,
+		blocks:   parent.blocks,
+		lineMark: parent.lineMark,
+	}
+}
+
+// lookup finds name in the innermost item of ctx holding it, as a key of a
+// map or a field or zero argument method of a struct, calling it when it
+// is a method. A name of "." is the innermost item itself. Names that are
+// not found are missing, not an error.
+func lookup(ctx interface{}, name string) (reflect.Value, error) {
+	s := scopeOf(ctx)
+	if name == "." {
+		return reflect.ValueOf(s.item), nil
+	}
+	for ; s != nil; s = s.parent {
+		if v, ok := find(s.item, name); ok {
+			return resolve(v)
 		}
-	} else {
-		dot["mussedScopeList"] = []*mussedRecord{changes}
 	}
+	return reflect.Value{}, nil
+}
 
-	return dot
+// find looks name up in a map, or in the exported fields (including those
+// promoted from embedded structs) and zero argument methods of a struct.
+// Methods are returned uncalled, see resolve.
+func find(i interface{}, name string) (interface{}, bool) {
+	switch {
+	case mapType(i):
+		return findMap(i, name)
+	case structType(i):
+		return findStruct(i, name)
+	}
+	return nil, false
 }
 
 func mapType(i interface{}) bool {
@@ -46,65 +87,80 @@ func mapType(i interface{}) bool {
 }
 
 func structType(i interface{}) bool {
+	if i == nil {
+		return false
+	}
 	it := reflect.TypeOf(i)
 	if it.Kind() == reflect.Ptr {
 		it = it.Elem()
 	}
 	return it.Kind() == reflect.Struct
 }
-func upscopeMap(dot map[string]interface{}, subject interface{}) *mussedRecord {
-	changes := &mussedRecord{
-		replaced: map[string]interface{}{},
-	}
 
+func findMap(subject interface{}, name string) (interface{}, bool) {
 	subjectValue := reflect.ValueOf(subject)
-	if subjectValue.Type().Kind() != reflect.Map {
-		return nil
-	}
-	for _, key := range subjectValue.MapKeys() {
-		keyName := key.String()
-		if val, ok := dot[keyName]; ok {
-			changes.replaced[keyName] = val
-		} else {
-			changes.added = append(changes.added, keyName)
-		}
-		dot[key.String()] = subjectValue.MapIndex(key).Interface()
+	keyType := subjectValue.Type().Key()
+	if keyType.Kind() != reflect.String {
+		return nil, false
+	}
+	value := subjectValue.MapIndex(reflect.ValueOf(name).Convert(keyType))
+	if !value.IsValid() {
+		return nil, false
 	}
-	return changes
+	return value.Interface(), true
 }
 
-func upscopeStruct(dot map[string]interface{}, subject interface{}) *mussedRecord {
-	return nil
-}
+func findStruct(subject interface{}, name string) (interface{}, bool) {
+	subjectValue := reflect.ValueOf(subject)
+	if subjectValue.Kind() == reflect.Ptr && subjectValue.IsNil() {
+		return nil, false
+	}
+	if fn := subjectValue.MethodByName(name); fn.IsValid() && niladic(fn.Type()) {
+		return method{name: name, fn: fn}, true
+	}
 
-func downscope(dot map[string]interface{}) map[string]interface{} {
-	record, ok := dot["mussedScopeList"]
-	if !ok {
-		return dot
+	subjectValue = reflect.Indirect(subjectValue)
+	field, ok := subjectValue.Type().FieldByName(name)
+	if !ok || !field.IsExported() {
+		return nil, false
 	}
-	records, ok := record.([]*mussedRecord)
-	if !ok {
-		return dot
+	fieldValue, err := subjectValue.FieldByIndexErr(field.Index)
+	if err != nil {
+		// promoted through a nil embedded pointer
+		return nil, false
 	}
-	if len(records) > 0 {
-		subject := records[len(records)-1]
+	return fieldValue.Interface(), true
+}
 
-		if subject == nil {
-			return dot
-		}
-		for _, added := range subject.added {
-			delete(dot, added)
-		}
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
-		for key, previous := range subject.replaced {
-			dot[key] = previous
-		}
-	}
+// niladic reports whether a method takes no arguments and returns either a
+// single value or a value and an error, the same shapes text/template
+// will call.
+func niladic(mt reflect.Type) bool {
+	return mt.NumIn() == 0 && (mt.NumOut() == 1 ||
+		mt.NumOut() == 2 && mt.Out(1) == errorType)
+}
 
-	return dot
+// method is a method of a struct in scope, waiting to be called.
+type method struct {
+	name string
+	fn   reflect.Value
 }
 
-type mussedRecord struct {
-	replaced map[string]interface{}
-	added    []string
+// resolve returns the value of i, the value found for a tag, calling it
+// first when it is a method of a struct in scope. An error from the method
+// fails the render as it would in text/template. The value is returned as
+// a reflect.Value, like that of a missing name, so that text/template
+// looks up any fields after it like it would in a map.
+func resolve(i interface{}) (reflect.Value, error) {
+	m, ok := i.(method)
+	if !ok {
+		return reflect.ValueOf(i), nil
+	}
+	out := m.fn.Call(nil)
+	if len(out) == 2 && !out[1].IsNil() {
+		return reflect.Value{}, fmt.Errorf("calling %s: %w", m.name, out[1].Interface().(error))
+	}
+	return reflect.ValueOf(out[0].Interface()), nil
 }
@@ -0,0 +1,242 @@
+package mussed
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type scopeAddress struct {
+	City string
+}
+
+type scopeUser struct {
+	scopeAddress
+	Name   string
+	hidden string
+}
+
+func (u *scopeUser) Greeting() string {
+	return "Hello " + u.Name
+}
+
+// scopeService counts the calls to its methods, which only the methods a
+// template refers to should see.
+type scopeService struct {
+	calls *int
+}
+
+func (s scopeService) Name() string {
+	*s.calls++
+	return "svc"
+}
+
+func (s scopeService) Delete() string {
+	*s.calls++
+	return "deleted"
+}
+
+func (s scopeService) Boom() (string, error) {
+	*s.calls++
+	return "", errors.New("boom")
+}
+
+func TestScopingStructMethodsLazy(t *testing.T) {
+	// Methods are only called by the tags that refer to them
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#list}}[{{Name}}]{{/list}}{{#one}}{{/one}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		calls := 0
+		svc := scopeService{calls: &calls}
+		data := map[string]interface{}{
+			"list": []scopeService{svc, svc, svc},
+			"one":  svc,
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`[svc][svc][svc]`, b.String())
+		test.AreEqual(3, calls)
+	})
+}
+
+func TestScopingStructMethodError(t *testing.T) {
+	// An error from a method in scope fails the render
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#list}}[{{Boom}}]{{/list}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		calls := 0
+		data := map[string]interface{}{
+			"list": []scopeService{{calls: &calls}},
+		}
+		err = t.ExecuteTemplate(new(bytes.Buffer), "test", data)
+		test.IsTrue(err != nil && strings.Contains(err.Error(), "calling Boom: boom"), err)
+	})
+}
+
+func TestScopingStruct(t *testing.T) {
+	// Struct fields, promoted fields and methods are pushed into scope
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#user}}{{Greeting}}, {{Name}} of {{City}} ({{outer}}){{/user}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := map[string]interface{}{
+			"outer": "outside",
+			"user": &scopeUser{
+				scopeAddress: scopeAddress{City: "Springfield"},
+				Name:         "Homer",
+				hidden:       "secret",
+			},
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`Hello Homer, Homer of Springfield (outside)`, b.String())
+	})
+}
+
+func TestScopingStructList(t *testing.T) {
+	// Each struct in a list is pushed into scope in turn
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#users}}[{{Name}}]{{/users}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := map[string]interface{}{
+			"users": []scopeUser{{Name: "a"}, {Name: "b"}},
+		}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`[a][b]`, b.String())
+	})
+}
+
+func TestScopingStructRoot(t *testing.T) {
+	// A struct used as the root context is visible inside sections
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#Items}}{{Name}}:{{.}} {{/Items}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := struct {
+			Name  string
+			Items []int
+		}{"n", []int{1, 2}}
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`n:1 n:2 `, b.String())
+	})
+}
+
+func TestScopingNoMutation(t *testing.T) {
+	// Sections neither modify the data nor leak keys between iterations
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#list}}[{{a}}{{#inner}}{{b}}{{/inner}}]{{/list}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"list":[{"a":1,"inner":{"b":2}},{"inner":true}]}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`[12][]`, b.String())
+		test.AreEqual(1, len(data))
+	})
+}
+
+func TestScopingConcurrent(t *testing.T) {
+	// Many goroutines may render the same template over shared data
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#list}}{{#item}}{{name}}{{/item}}{{/list}}`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"list":[{"item":{"name":"a"}},{"item":{"name":"b"}}]}`), &data))
+		test.IsNil(t.ExecuteTemplate(new(bytes.Buffer), "test", data))
+
+		var wg sync.WaitGroup
+		results := make([]string, 16)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				b := new(bytes.Buffer)
+				if err := t.ExecuteTemplate(b, "test", data); err == nil {
+					results[i] = b.String()
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, result := range results {
+			test.AreEqual(`ab`, result)
+		}
+	})
+}
+
+func TestScopingLinked(t *testing.T) {
+	// Entering a section costs the same however much data is in scope
+
+	within(t, func(test *aTest) {
+		allocs := func(keys int) float64 {
+			data := make(map[string]interface{})
+			for i := 0; i < keys; i++ {
+				data[strconv.Itoa(i)] = i
+			}
+			return testing.AllocsPerRun(10, func() {
+				upscope(upscope(data, data), 1)
+			})
+		}
+		test.AreEqual(allocs(1), allocs(10000))
+
+		scope := upscope(map[string]interface{}{"a": 1, "b": 2}, map[string]int{"a": 3})
+		for name, want := range map[string]int{"a": 3, "b": 2} {
+			found, err := lookup(scope, name)
+			test.IsNil(err)
+			test.AreEqual(want, found.Interface())
+		}
+	})
+}
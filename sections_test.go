@@ -535,10 +535,7 @@ func TestSECTIONS21(t *testing.T) {
 
 	within(t, func(test *aTest) {
 		t := template.New("test").Funcs(RequiredFuncs)
-		trees, err := Parse("test.mustache", `|
-{{#boolean}}
-{{/boolean}}
-|`)
+		trees, err := Parse("test.mustache", "|\r\n{{#boolean}}\r\n{{/boolean}}\r\n|")
 		test.IsNil(err)
 		for name, tree := range trees {
 			t, err = t.AddParseTree(name, tree)
@@ -549,8 +546,7 @@ func TestSECTIONS21(t *testing.T) {
 		test.IsNil(json.Unmarshal([]byte(`{"boolean":true}`), &data))
 		b := new(bytes.Buffer)
 		test.IsNil(t.ExecuteTemplate(b, "test", data))
-		test.AreEqual(`|
-|`, b.String())
+		test.AreEqual("|\r\n|", b.String())
 	})
 }
 
@@ -620,3 +616,23 @@ func TestSECTIONS24(t *testing.T) {
 		test.AreEqual(`|=|`, b.String())
 	})
 }
+
+func TestSECTIONSDeepNesting(t *testing.T) {
+	// Sections may nest to any depth
+
+	within(t, func(test *aTest) {
+		t := template.New("test").Funcs(RequiredFuncs)
+		trees, err := Parse("test.mustache", `{{#a}}1{{#b}}2{{#c}}3{{#d}}4{{/d}}3{{/c}}2{{/b}}1{{/a}}0`)
+		test.IsNil(err)
+		for name, tree := range trees {
+			t, err = t.AddParseTree(name, tree)
+			test.IsNil(err)
+		}
+
+		data := make(map[string]interface{})
+		test.IsNil(json.Unmarshal([]byte(`{"a":true,"b":true,"c":true,"d":true}`), &data))
+		b := new(bytes.Buffer)
+		test.IsNil(t.ExecuteTemplate(b, "test", data))
+		test.AreEqual(`12343210`, b.String())
+	})
+}
@@ -0,0 +1,134 @@
+package mussed
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// specSuite is a suite of the mustache spec as found in specs.
+type specSuite struct {
+	Tests []struct {
+		Name     string                 `json:"name"`
+		Data     map[string]interface{} `json:"data"`
+		Template string                 `json:"template"`
+		Partials map[string]string      `json:"partials"`
+		Expected string                 `json:"expected"`
+	} `json:"tests"`
+}
+
+// specSkipped names the spec tests mussed knowingly differs on, which the
+// README lists, as suite/test.
+var specSkipped = map[string]bool{
+	"partials/Failed Lookup": true, // missing partials are errors
+	"partials/Recursion":     true, // html/template escapes the '<'
+}
+
+// loadSpecSuite reads the suite in specs/<name>.json straight from the
+// JSON, which keeps line endings such as \r\n that the generated test
+// files lose to Go's raw strings, dropping the tests in specSkipped.
+func loadSpecSuite(t *testing.T, name string) specSuite {
+	buf, err := ioutil.ReadFile(filepath.Join("specs", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var suite specSuite
+	if err = json.Unmarshal(buf, &suite); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := suite.Tests[:0]
+	for _, spec := range suite.Tests {
+		if !specSkipped[name+"/"+spec.Name] {
+			tests = append(tests, spec)
+		}
+	}
+	suite.Tests = tests
+	return suite
+}
+
+// parseSpec parses the template and partials of a spec test, handing each
+// tree to add.
+func parseSpec(test *aTest, template string, partials map[string]string, add func(string, *parse.Tree) error) {
+	sources := map[string]string{"test.mustache": template}
+	for partial, source := range partials {
+		sources[partial+".mustache"] = source
+	}
+	for file, source := range sources {
+		trees, err := Parse(file, source)
+		test.IsNil(err)
+		for name, tree := range trees {
+			test.IsNil(add(name, tree))
+		}
+	}
+}
+
+// runSpecSuite runs every test of the suite in specs/<name>.json with
+// html/template, through a set passed to Attach.
+func runSpecSuite(t *testing.T, name string) {
+	for _, spec := range loadSpecSuite(t, name).Tests {
+		within(t, func(test *aTest) {
+			test.Section(spec.Name)
+			t := Attach(template.New("test"))
+			parseSpec(test, spec.Template, spec.Partials, func(name string, tree *parse.Tree) error {
+				_, err := t.AddParseTree(name, tree)
+				return err
+			})
+
+			b := new(bytes.Buffer)
+			test.IsNil(t.ExecuteTemplate(b, "test", spec.Data))
+			test.AreEqual(spec.Expected, b.String())
+		})
+	}
+}
+
+// runTextSpecSuite runs every test of the suite in specs/<name>.json with
+// text/template, escaping values with MustacheEscaping.
+func runTextSpecSuite(t *testing.T, name string) {
+	for _, spec := range loadSpecSuite(t, name).Tests {
+		within(t, func(test *aTest) {
+			test.Section(spec.Name)
+			t := texttemplate.New("test").
+				Funcs(texttemplate.FuncMap(RequiredFuncs)).
+				Funcs(texttemplate.FuncMap(MustacheEscaping))
+			parseSpec(test, spec.Template, spec.Partials, func(name string, tree *parse.Tree) error {
+				_, err := t.AddParseTree(name, tree)
+				return err
+			})
+
+			b := new(bytes.Buffer)
+			test.IsNil(t.ExecuteTemplate(b, "test", spec.Data))
+			test.AreEqual(spec.Expected, b.String())
+		})
+	}
+}
+
+func TestSpecComments(t *testing.T) {
+	runSpecSuite(t, "comments")
+}
+
+func TestSpecDelimiters(t *testing.T) {
+	runSpecSuite(t, "delimiters")
+}
+
+func TestSpecInterpolationMustacheEscaping(t *testing.T) {
+	// escaping matches the spec exactly, where html/template uses &#34;
+	runTextSpecSuite(t, "interpolation")
+}
+
+func TestSpecInverted(t *testing.T) {
+	runSpecSuite(t, "inverted")
+}
+
+func TestSpecPartials(t *testing.T) {
+	runSpecSuite(t, "partials")
+}
+
+func TestSpecSections(t *testing.T) {
+	runSpecSuite(t, "sections")
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -30,11 +31,11 @@ func main() {
 			}
 			for i, t := range s.Tests {
 				b, _ := json.Marshal(t.Data)
-				t.Marshalled = "`" + string(b) + "`"
-				t.Template = "`" + t.Template + "`"
-				t.Expected = "`" + t.Expected + "`"
+				t.Marshalled = quote(string(b))
+				t.Template = quote(t.Template)
+				t.Expected = quote(t.Expected)
 				for k, v := range t.Partials {
-					t.Partials[k] = "`" + v + "`"
+					t.Partials[k] = quote(v)
 				}
 				s.Tests[i] = t
 			}
@@ -51,6 +52,15 @@ func main() {
 	})
 }
 
+// quote returns s as a Go string literal, a raw string unless s holds
+// characters a raw string would lose, like the \r of \r\n line endings.
+func quote(s string) string {
+	if strings.ContainsAny(s, "\r`") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
 type Spec struct {
 	Title    string
 	Overview string `json:"overview"`
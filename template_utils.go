@@ -39,17 +39,17 @@ func safeAction(s string) (*parse.ActionNode, error) {
 	}
 }
 
-func addEmbeddable(tn *parse.TextNode) []parse.Node {
+func addEmbeddable(tn *parse.TextNode, left, right string) []parse.Node {
 	output := make([]parse.Node, 0)
 	workingText := string(tn.Text)
-	for containsDelimeters(workingText) {
-		index := strings.Index(workingText, LeftDelim)
+	for containsDelimeters(workingText, left, right) {
+		index := strings.Index(workingText, left)
 		output = append(output, newTextNode(workingText[:index]))
 		workingText = workingText[index:]
 
-		index = strings.Index(workingText, RightDelim)
-		pipeText := workingText[:index+len(RightDelim)]
-		workingText = workingText[index+len(RightDelim):]
+		index = strings.Index(workingText, right)
+		pipeText := workingText[:index+len(right)]
+		workingText = workingText[index+len(right):]
 
 		action, e := safeAction(pipeText)
 		if e != nil {
@@ -66,7 +66,7 @@ func addEmbeddable(tn *parse.TextNode) []parse.Node {
 	return output
 }
 
-func containsDelimeters(s string) bool {
-	return strings.Contains(string(s), RightDelim) &&
-		strings.Contains(string(s), LeftDelim)
+func containsDelimeters(s, left, right string) bool {
+	return strings.Contains(string(s), right) &&
+		strings.Contains(string(s), left)
 }